@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+func (app *application) listMovieAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+	region := data.NormalizeRegion(r.URL.Query().Get("region"))
+	v := validator.New()
+	v.Check(region == "" || validator.Matches(region, data.RegionRX), "region", "must be a two letter ISO 3166 country code")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	availability, err := app.models.Availability.GetAllForMovie(movie.ID, region)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"availability": availability}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createMovieAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Region   string     `json:"region"`
+		Provider string     `json:"provider"`
+		Type     string     `json:"type"`
+		StartsOn data.Date  `json:"starts_on"`
+		EndsOn   *data.Date `json:"ends_on"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	a := &data.Availability{
+		MovieID:  movie.ID,
+		Region:   data.NormalizeRegion(input.Region),
+		Provider: data.NormalizeProvider(input.Provider),
+		Type:     input.Type,
+		StartsOn: input.StartsOn,
+		EndsOn:   input.EndsOn,
+	}
+	v := validator.New()
+	if data.ValidateAvailability(v, a); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Availability.Insert(a)
+	if err != nil {
+		app.availabilityErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/availability/%d", movie.ID, a.ID))
+	err = app.writeJson(w, http.StatusCreated, envelope{"availability": a}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMovieAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := app.readAvailability(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Region   *string    `json:"region"`
+		Provider *string    `json:"provider"`
+		Type     *string    `json:"type"`
+		StartsOn *data.Date `json:"starts_on"`
+		// EndsOn can be set to null to make the window open ended, so
+		// whether it was sent at all is tracked separately.
+		EndsOn optionalDate `json:"ends_on"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Region != nil {
+		a.Region = data.NormalizeRegion(*input.Region)
+	}
+	if input.Provider != nil {
+		a.Provider = data.NormalizeProvider(*input.Provider)
+	}
+	if input.Type != nil {
+		a.Type = *input.Type
+	}
+	if input.StartsOn != nil {
+		a.StartsOn = *input.StartsOn
+	}
+	if input.EndsOn.Set {
+		a.EndsOn = input.EndsOn.Date
+	}
+	v := validator.New()
+	if data.ValidateAvailability(v, a); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Availability.Update(a)
+	if err != nil {
+		app.availabilityErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"availability": a}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieAvailabilityHandler(w http.ResponseWriter, r *http.Request) {
+	a, ok := app.readAvailability(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Availability.Delete(a.MovieID, a.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "availability successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// optionalDate is a JSON date that tells a missing value apart from null.
+type optionalDate struct {
+	Set  bool
+	Date *data.Date
+}
+
+func (o *optionalDate) UnmarshalJSON(jsonValue []byte) error {
+	o.Set = true
+	if string(jsonValue) == "null" {
+		o.Date = nil
+		return nil
+	}
+	o.Date = new(data.Date)
+	return o.Date.UnmarshalJSON(jsonValue)
+}
+
+// readAvailability loads the availability record named by the
+// :availability_id parameter of the movie named by :id.
+func (app *application) readAvailability(w http.ResponseWriter, r *http.Request) (*data.Availability, bool) {
+	movieID, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	id, err := strconv.ParseInt(httprouter.ParamsFromContext(r.Context()).ByName("availability_id"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	a, err := app.models.Availability.Get(movieID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return a, true
+}
+
+func (app *application) availabilityErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	case errors.Is(err, data.ErrDuplicateAvailability):
+		app.failedValidationResponse(w, r, map[string]string{"starts_on": "a window for this region, provider and type already starts on this date"})
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
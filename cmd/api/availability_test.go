@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOptionalDate(t *testing.T) {
+	var input struct {
+		EndsOn optionalDate `json:"ends_on"`
+	}
+
+	_ = json.Unmarshal([]byte(`{}`), &input)
+	if input.EndsOn.Set {
+		t.Error("expected a missing date not to be set")
+	}
+
+	_ = json.Unmarshal([]byte(`{"ends_on": null}`), &input)
+	if !input.EndsOn.Set || input.EndsOn.Date != nil {
+		t.Errorf("expected null to clear the date, got %+v", input.EndsOn)
+	}
+
+	err := json.Unmarshal([]byte(`{"ends_on": "2025-06-30"}`), &input)
+	if err != nil || input.EndsOn.Date == nil || input.EndsOn.Date.Format("2006-01-02") != "2025-06-30" {
+		t.Errorf("expected the date to be parsed, got %+v (%v)", input.EndsOn, err)
+	}
+
+	err = json.Unmarshal([]byte(`{"ends_on": "soon"}`), &input)
+	if err == nil {
+		t.Error("expected an invalid date to be rejected")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+const maxBatchOperations = 1000
+
+const (
+	batchModeAtomic  = "atomic"
+	batchModePartial = "partial"
+)
+
+type batchMovieInput struct {
+	Title    *string       `json:"title"`
+	Year     *int32        `json:"year"`
+	Runtime  *data.Runtime `json:"runtime"`
+	Genres   []string      `json:"genres"`
+	Synopsis *string       `json:"synopsis"`
+}
+
+// apply copies the fields that were provided onto movie.
+func (in batchMovieInput) apply(movie *data.Movie) {
+	if in.Title != nil {
+		movie.Title = *in.Title
+	}
+	if in.Year != nil {
+		movie.Year = *in.Year
+	}
+	if in.Runtime != nil {
+		movie.Runtime = int32(*in.Runtime)
+	}
+	if in.Genres != nil {
+		movie.Genres = in.Genres
+	}
+	if in.Synopsis != nil {
+		movie.Synopsis = *in.Synopsis
+	}
+}
+
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version *int32          `json:"version"`
+	Movie   batchMovieInput `json:"movie"`
+}
+
+type batchResult struct {
+	Index  int               `json:"index"`
+	Op     string            `json:"op"`
+	Status int               `json:"status"`
+	Movie  *data.Movie       `json:"movie,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// batchItemError is the failure of a single operation. It is reported back to
+// the client against the operation's index instead of as a server error.
+type batchItemError struct {
+	status int
+	errors map[string]string
+}
+
+func (e *batchItemError) Error() string {
+	return http.StatusText(e.status)
+}
+
+var errBatchAborted = errors.New("batch aborted")
+
+func (app *application) batchMovieHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = batchModeAtomic
+	}
+
+	v := validator.New()
+	v.Check(validator.In(input.Mode, batchModeAtomic, batchModePartial), "mode", "must be either atomic or partial")
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least 1 operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", "must not contain more than 1000 operations")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	results := make([]batchResult, len(input.Operations))
+
+	// Validate everything that can be checked without the database first,
+	// collecting new movies so they can be inserted together.
+	var creates []*data.Movie
+	var createIndexes []int
+	for i, op := range input.Operations {
+		results[i] = batchResult{Index: i, Op: op.Op}
+		v := validator.New()
+		switch op.Op {
+		case "create":
+			movie := &data.Movie{}
+			op.Movie.apply(movie)
+			if data.ValidateMovie(v, movie, app.config.movieRules); v.Valid() {
+				creates = append(creates, movie)
+				createIndexes = append(createIndexes, i)
+			}
+		case "update", "delete":
+			v.Check(op.ID > 0, "id", "must be a positive integer")
+		default:
+			v.AddError("op", "must be one of create, update or delete")
+		}
+		if !v.Valid() {
+			results[i].Status = http.StatusUnprocessableEntity
+			results[i].Errors = v.Errors
+		}
+	}
+	if input.Mode == batchModeAtomic && app.batchFailed(w, r, results) {
+		return
+	}
+
+	err = app.models.InTx(r.Context(), func(tx data.Models) error {
+		if len(creates) > 0 {
+			err := app.batchCreate(tx, input.Mode, user.ID, creates, createIndexes, results)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, op := range input.Operations {
+			if op.Op == "create" || results[i].Status != 0 {
+				continue
+			}
+			apply := func() error {
+				return app.batchApply(tx, user.ID, op, &results[i])
+			}
+			if input.Mode == batchModePartial {
+				err := tx.Savepoint(apply)
+				if err != nil {
+					app.recordBatchError(r, &results[i], err)
+				}
+				continue
+			}
+			err := apply()
+			if err != nil {
+				var itemErr *batchItemError
+				if errors.As(err, &itemErr) {
+					results[i].Status = itemErr.status
+					results[i].Errors = itemErr.errors
+					return errBatchAborted
+				}
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errBatchAborted):
+			app.batchFailed(w, r, results)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.moviesChanged()
+
+	err = app.writeJson(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// batchFailed sends the per-item errors of an atomic batch, keyed by the
+// index of the operation, and reports whether there were any.
+func (app *application) batchFailed(w http.ResponseWriter, r *http.Request, results []batchResult) bool {
+	errs := make(map[string]map[string]string)
+	for _, result := range results {
+		if result.Errors != nil {
+			errs[strconv.Itoa(result.Index)] = result.Errors
+		}
+	}
+	if len(errs) == 0 {
+		return false
+	}
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, errs)
+	return true
+}
+
+func (app *application) recordBatchError(r *http.Request, result *batchResult, err error) {
+	var itemErr *batchItemError
+	if errors.As(err, &itemErr) {
+		result.Status = itemErr.status
+		result.Errors = itemErr.errors
+		return
+	}
+	app.logError(r, err)
+	result.Status = http.StatusInternalServerError
+	result.Errors = map[string]string{"error": "the server encountered a problem and could not process this operation"}
+}
+
+// batchCreate inserts all new movies with multi-row inserts. In partial mode a
+// failing insert falls back to inserting the movies one at a time, so only the
+// offending rows are reported.
+func (app *application) batchCreate(tx data.Models, mode string, userID int64, movies []*data.Movie, indexes []int, results []batchResult) error {
+	insert := func(movies []*data.Movie) error {
+		err := tx.Movies.InsertMany(movies)
+		if err != nil {
+			return err
+		}
+		for _, movie := range movies {
+			err := tx.Revisions.Insert(data.NewMovieRevision(data.RevisionCreate, userID, nil, movie))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if mode == batchModeAtomic {
+		err = insert(movies)
+	} else {
+		err = tx.Savepoint(func() error { return insert(movies) })
+	}
+	if err == nil {
+		for j, movie := range movies {
+			results[indexes[j]].Status = http.StatusCreated
+			results[indexes[j]].Movie = movie
+		}
+		return nil
+	}
+	if mode == batchModeAtomic {
+		return err
+	}
+
+	for j, movie := range movies {
+		result := &results[indexes[j]]
+		err := tx.Savepoint(func() error { return insert([]*data.Movie{movie}) })
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"batch_index": strconv.Itoa(result.Index)})
+			result.Status = http.StatusInternalServerError
+			result.Errors = map[string]string{"error": "the server encountered a problem and could not process this operation"}
+			continue
+		}
+		result.Status = http.StatusCreated
+		result.Movie = movie
+	}
+	return nil
+}
+
+// batchApply runs a single update or delete operation.
+func (app *application) batchApply(tx data.Models, userID int64, op batchOperation, result *batchResult) error {
+	movie, err := tx.Movies.Get(op.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return &batchItemError{http.StatusNotFound, map[string]string{"id": "movie not found"}}
+		default:
+			return err
+		}
+	}
+	if op.Version != nil && *op.Version != movie.Version {
+		return &batchItemError{http.StatusConflict, map[string]string{"version": "does not match the current version"}}
+	}
+	before := *movie
+
+	action := data.RevisionUpdate
+	switch op.Op {
+	case "update":
+		op.Movie.apply(movie)
+		v := validator.New()
+		if data.ValidateMovie(v, movie, app.config.movieRules); !v.Valid() {
+			return &batchItemError{http.StatusUnprocessableEntity, v.Errors}
+		}
+		err = tx.Movies.Update(movie)
+	case "delete":
+		action = data.RevisionDelete
+		err = tx.Movies.Delete(movie)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &batchItemError{http.StatusConflict, map[string]string{"version": "the movie was modified concurrently"}}
+		default:
+			return err
+		}
+	}
+
+	err = tx.Revisions.Insert(data.NewMovieRevision(action, userID, &before, movie))
+	if err != nil {
+		return err
+	}
+	result.Status = http.StatusOK
+	if op.Op == "update" {
+		result.Movie = movie
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/jsonlog"
+)
+
+func TestBatchMovieHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantKeys   []string
+	}{
+		{
+			name:       "unknown mode",
+			body:       `{"mode":"sometimes","operations":[{"op":"delete","id":1}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   []string{"mode"},
+		},
+		{
+			name:       "no operations",
+			body:       `{"operations":[]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   []string{"operations"},
+		},
+		{
+			name: "per item errors keyed by index",
+			body: `{"operations":[
+				{"op":"create","movie":{"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation"]}},
+				{"op":"create","movie":{"title":"","year":2016,"runtime":"107 mins","genres":["animation"]}},
+				{"op":"update"},
+				{"op":"rename","id":4}
+			]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantKeys:   []string{"1", "2", "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff)}
+			app.config.movieRules = data.DefaultMovieRules
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/movies/batch", strings.NewReader(tt.body))
+			r = app.contextSetUser(r, data.AnonymousUser)
+			w := httptest.NewRecorder()
+
+			app.batchMovieHandler(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body)
+			}
+			var response struct {
+				Error map[string]any `json:"error"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Error) != len(tt.wantKeys) {
+				t.Errorf("expected errors for %v, got %v", tt.wantKeys, response.Error)
+			}
+			for _, key := range tt.wantKeys {
+				if _, ok := response.Error[key]; !ok {
+					t.Errorf("expected an error for %q, got %v", key, response.Error)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// exportFlushEvery is how many rows are written between flushes of the
+// response, so clients start receiving data straight away.
+const exportFlushEvery = 500
+
+// exportCSVHeader matches the column names understood by the importer, so an
+// export can be imported again.
+var exportCSVHeader = []string{"id", "external_id", "title", "year", "runtime", "genres", "created_at", "version"}
+
+// movieEncoder writes movies in one export format.
+type movieEncoder interface {
+	Encode(movie *data.Movie) error
+	Flush() error
+}
+
+type csvMovieEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVMovieEncoder(w io.Writer) (*csvMovieEncoder, error) {
+	enc := &csvMovieEncoder{w: csv.NewWriter(w)}
+	return enc, enc.w.Write(exportCSVHeader)
+}
+
+func (e *csvMovieEncoder) Encode(movie *data.Movie) error {
+	return e.w.Write([]string{
+		strconv.FormatInt(movie.ID, 10),
+		movie.ExternalID,
+		movie.Title,
+		strconv.Itoa(int(movie.Year)),
+		strconv.Itoa(int(movie.Runtime)),
+		strings.Join(movie.Genres, "|"),
+		movie.CreatedAt.Format(time.RFC3339),
+		strconv.Itoa(int(movie.Version)),
+	})
+}
+
+func (e *csvMovieEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonMovieEncoder struct {
+	enc *json.Encoder
+}
+
+func (e ndjsonMovieEncoder) Encode(movie *data.Movie) error {
+	return e.enc.Encode(movie)
+}
+
+func (e ndjsonMovieEncoder) Flush() error {
+	return nil
+}
+
+func (app *application) exportMovieHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	format := app.readString(qs, "format", "csv")
+	filter := app.readMovieFilter(qs, v)
+
+	v.Check(validator.In(format, "csv", "ndjson"), "format", "must be either csv or ndjson")
+	data.ValidateMovieFilter(v, filter)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// An export can take much longer than the server's write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	var enc movieEncoder
+	started := false
+	start := func() error {
+		contentType := "text/csv; charset=utf-8"
+		if format == "ndjson" {
+			contentType = "application/x-ndjson"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="movies-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+		w.WriteHeader(http.StatusOK)
+		started = true
+
+		if format == "ndjson" {
+			enc = ndjsonMovieEncoder{enc: json.NewEncoder(w)}
+			return nil
+		}
+		var err error
+		enc, err = newCSVMovieEncoder(w)
+		return err
+	}
+
+	rows := 0
+	err := app.models.Movies.Export(r.Context(), filter, func(movie *data.Movie) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(movie); err != nil {
+			return err
+		}
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+		return nil
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err != nil {
+		switch {
+		case !started:
+			app.serverErrorResponse(w, r, err)
+		case errors.Is(err, context.Canceled):
+			// The client went away; there is nobody left to tell.
+		default:
+			// The status line has already been sent, so all that can be done
+			// is to cut the download short.
+			app.logError(r, err)
+		}
+		return
+	}
+	err = enc.Flush()
+	if err != nil {
+		app.logError(r, err)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/importer"
+	"lightsaber.dkadev.xyz/internal/jsonlog"
+)
+
+func TestCSVMovieEncoderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := newCSVMovieEncoder(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	movie := &data.Movie{
+		ID:         7,
+		ExternalID: "tt0133093",
+		Title:      "The Matrix, Reloaded",
+		Year:       2003,
+		Runtime:    138,
+		Genres:     []string{"action", "sci-fi"},
+		CreatedAt:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Version:    3,
+	}
+	if err := enc.Encode(movie); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id,external_id,title,year,runtime,genres,created_at,version\n" +
+		"7,tt0133093,\"The Matrix, Reloaded\",2003,138,action|sci-fi,2026-01-02T03:04:05Z,3\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+
+	rows, err := importer.Parse(importer.FormatCSV, buf.Bytes(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].ExternalID != movie.ExternalID || rows[0].Movie.Title != movie.Title ||
+		rows[0].Movie.Runtime != movie.Runtime || len(rows[0].Movie.Genres) != 2 {
+		t.Errorf("export did not round-trip through the importer: %+v", rows)
+	}
+}
+
+func TestExportMovieHandlerRejectsUnknownFormat(t *testing.T) {
+	app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff)}
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies/export?format=parquet", nil)
+	w := httptest.NewRecorder()
+
+	app.exportMovieHandler(w, r)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422, got %d", w.Code)
+	}
+}
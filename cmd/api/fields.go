@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// readFields reads a sparse fieldset such as fields=id,title,year. nil means
+// all fields.
+func (app *application) readFields(qs url.Values, v *validator.Validator) []string {
+	fields := app.readCSV(qs, "fields", nil)
+	for _, field := range fields {
+		if !validator.In(field, data.MovieFields...) {
+			v.AddError("fields", "must be a list of movie fields")
+			break
+		}
+	}
+	v.Check(validator.Unique(fields), "fields", "must not contain duplicate values")
+	return fields
+}
+
+// sparseMovie narrows the JSON representation of movie to the requested
+// fields. Search match details, the locale, the collection and tags are kept
+// since they are not movie fields.
+func sparseMovie(movie *data.Movie, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return movie, nil
+	}
+	js, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(js, &all)
+	if err != nil {
+		return nil, err
+	}
+	sparse := make(map[string]json.RawMessage, len(fields)+4)
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			sparse[field] = value
+		}
+	}
+	for _, extra := range []string{"search", "locale", "collection", "tags"} {
+		if value, ok := all[extra]; ok {
+			sparse[extra] = value
+		}
+	}
+	return sparse, nil
+}
+
+func sparseMovies(movies []*data.Movie, fields []string) (any, error) {
+	if len(fields) == 0 {
+		return movies, nil
+	}
+	sparse := make([]any, len(movies))
+	for i, movie := range movies {
+		var err error
+		sparse[i], err = sparseMovie(movie, fields)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sparse, nil
+}
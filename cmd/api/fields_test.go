@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+func TestSparseMovie(t *testing.T) {
+	movie := &data.Movie{ID: 1, Title: "Moana", Year: 2016, Runtime: 107, Genres: []string{"animation"}, Version: 2}
+
+	body, err := sparseMovie(movie, []string{"id", "title", "runtime"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, _ := json.Marshal(body)
+	want := `{"id":1,"runtime":"107 mins","title":"Moana"}`
+	if string(js) != want {
+		t.Errorf("got %s, want %s", js, want)
+	}
+
+	full, _ := sparseMovie(movie, nil)
+	if full != movie {
+		t.Error("expected no fields to return the movie unchanged")
+	}
+}
+
+func TestReadFields(t *testing.T) {
+	app := &application{}
+	tests := []struct {
+		query   string
+		wantErr bool
+	}{
+		{"fields=id,title", false},
+		{"", false},
+		{"fields=id,password", true},
+		{"fields=id,id", true},
+		{"fields=deleted_at", true},
+	}
+	for _, tt := range tests {
+		qs, _ := url.ParseQuery(tt.query)
+		v := validator.New()
+		app.readFields(qs, v)
+		if v.Valid() == tt.wantErr {
+			t.Errorf("%q: expected error %v, got %v", tt.query, tt.wantErr, v.Errors)
+		}
+	}
+}
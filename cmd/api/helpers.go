@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"maps"
 
 	"github.com/julienschmidt/httprouter"
+	"lightsaber.dkadev.xyz/internal/data"
 	"lightsaber.dkadev.xyz/internal/validator"
 )
 
@@ -91,6 +93,43 @@ func (app *application) readJson(w http.ResponseWriter, r *http.Request, dst any
 	return nil
 }
 
+func (app *application) readFile(w http.ResponseWriter, r *http.Request, field string, maxBytes int64) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.New("body must be a multipart/form-data upload")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.Is(err, io.EOF):
+				return nil, fmt.Errorf("body must contain a %q file", field)
+			case errors.As(err, &maxBytesError):
+				return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+			default:
+				return nil, errors.New("body contains a badly-formed multipart upload")
+			}
+		}
+		if part.FormName() != field {
+			continue
+		}
+		content, err := io.ReadAll(part)
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+			}
+			return nil, err
+		}
+		if len(content) == 0 {
+			return nil, fmt.Errorf("%s file must not be empty", field)
+		}
+		return content, nil
+	}
+}
+
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
 	s := qs.Get(key)
 	if s == "" {
@@ -120,6 +159,145 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+	return f
+}
+
+// movieETag is the strong entity tag of a movie's stored state. Writes check
+// If-Match against it.
+func movieETag(movie *data.Movie) string {
+	return fmt.Sprintf(`"%d"`, movie.Version)
+}
+
+// showETag builds the entity tag of a single movie response. Unlike movieETag
+// it also changes with the requested fields, the translation shown, when the
+// movie is moved between collections and when it is tagged. It is the movie's
+// version followed by a hash of the rest, so checkIfMatch accepts it for
+// writes to that version.
+func showETag(movie *data.Movie, fields []string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%d;%v;", movie.ID, movie.Version, fields)
+	if c := movie.Collection; c != nil {
+		fmt.Fprintf(h, "%d:%s:%d;", c.ID, c.Name, c.Position)
+	}
+	fmt.Fprintf(h, "%v;", movie.Tags)
+	fmt.Fprintf(h, "%s:%s:%s;", movie.Locale, movie.Title, movie.Synopsis)
+	return fmt.Sprintf(`"%d-%x"`, movie.Version, h.Sum(nil)[:16])
+}
+
+// versionETags replaces every strong "<version>-<hash>" tag of showETag in an
+// If-Match header with the "<version>" tag of movieETag.
+func versionETags(header string) string {
+	candidates := strings.Split(header, ",")
+	for i, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if version, _, ok := strings.Cut(candidate, "-"); ok && strings.HasPrefix(candidate, `"`) {
+			candidate = version + `"`
+		}
+		candidates[i] = candidate
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// listETag builds a weak entity tag for a page of movies. It changes whenever
+// a movie on the page is added, removed, updated, translated, moved between
+// collections or tagged, the total changes, or any of the extra values
+// included in the response change.
+func listETag(movies []*data.Movie, metadata data.Metadata, extra ...any) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d;%v;", metadata.TotalRecords, extra)
+	for _, movie := range movies {
+		fmt.Fprintf(h, "%d:%d;", movie.ID, movie.Version)
+		if c := movie.Collection; c != nil {
+			fmt.Fprintf(h, "%d:%s:%d;", c.ID, c.Name, c.Position)
+		}
+		fmt.Fprintf(h, "%v;", movie.Tags)
+		if movie.Locale != "" {
+			fmt.Fprintf(h, "%s:%s:%s;", movie.Locale, movie.Title, movie.Synopsis)
+		}
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum(nil)[:16])
+}
+
+// etagMatches reports whether etag is listed in an If-Match or If-None-Match
+// header value. If-Match requires strong comparison, so weak tags never match
+// when strong is true.
+func etagMatches(header, etag string, strong bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strings.HasPrefix(candidate, "W/") {
+			if strong {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces the If-Match precondition for a write to a resource
+// currently tagged etag. It sends the error response itself and returns false
+// when the request must not proceed.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if app.config.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+	if !etagMatches(versionETags(header), etag, true) {
+		app.preconditionFailedResponse(w, r)
+		return false
+	}
+	return true
+}
+
+// notModified sends a 304 response and returns true if the If-None-Match
+// header of a GET request matches etag.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatches(header, etag, false) {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
 	go func() {
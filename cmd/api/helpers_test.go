@@ -0,0 +1,160 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/jsonlog"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		etag   string
+		strong bool
+		want   bool
+	}{
+		{"exact", `"3"`, `"3"`, true, true},
+		{"different", `"2"`, `"3"`, true, false},
+		{"list", `"1", "3"`, `"3"`, true, true},
+		{"wildcard", `*`, `"3"`, true, true},
+		{"weak header strong compare", `W/"3"`, `"3"`, true, false},
+		{"weak header weak compare", `W/"3"`, `"3"`, false, true},
+		{"weak etag strong compare", `W/"abc"`, `W/"abc"`, true, false},
+		{"weak etag weak compare", `"abc"`, `W/"abc"`, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, tt.etag, tt.strong); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	movie := &data.Movie{ID: 1, Version: 3}
+
+	tests := []struct {
+		name       string
+		header     string
+		required   bool
+		wantOK     bool
+		wantStatus int
+	}{
+		{"missing header allowed", "", false, true, http.StatusOK},
+		{"missing header required", "", true, false, http.StatusPreconditionRequired},
+		{"matching version", `"3"`, true, true, http.StatusOK},
+		{"stale version", `"2"`, false, false, http.StatusPreconditionFailed},
+		{"show etag", showETag(movie, []string{"title"}), true, true, http.StatusOK},
+		{"stale show etag", showETag(&data.Movie{ID: 1, Version: 2}, nil), false, false, http.StatusPreconditionFailed},
+		{"weak show etag", "W/" + showETag(movie, nil), false, false, http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff)}
+			app.config.requireIfMatch = tt.required
+
+			r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			if ok := app.checkIfMatch(w, r, movieETag(movie)); ok != tt.wantOK {
+				t.Errorf("expected %v, got %v", tt.wantOK, ok)
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff)}
+	movies := []*data.Movie{{ID: 1, Version: 1}, {ID: 2, Version: 4}}
+	etag := listETag(movies, data.Metadata{TotalRecords: 2})
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.Header.Set("If-None-Match", etag)
+	w := httptest.NewRecorder()
+	if !app.notModified(w, r, etag) {
+		t.Fatal("expected matching If-None-Match to be not modified")
+	}
+	if w.Code != http.StatusNotModified {
+		t.Errorf("expected status 304, got %d", w.Code)
+	}
+
+	movies[1].Version = 5
+	w = httptest.NewRecorder()
+	if app.notModified(w, r, listETag(movies, data.Metadata{TotalRecords: 2})) {
+		t.Error("expected a changed page to produce a new etag")
+	}
+}
+
+func TestListETagIncludesFacets(t *testing.T) {
+	movies := []*data.Movie{{ID: 1, Version: 1}}
+	metadata := data.Metadata{TotalRecords: 1}
+	before := map[string][]data.FacetCount{"genres": {{Value: "drama", Count: 3}}}
+	after := map[string][]data.FacetCount{"genres": {{Value: "drama", Count: 4}}}
+
+	if listETag(movies, metadata, before) == listETag(movies, metadata, after) {
+		t.Error("expected changed facet counts to produce a new etag")
+	}
+	if listETag(movies, metadata, before) != listETag(movies, metadata, before) {
+		t.Error("expected the etag to be stable")
+	}
+}
+
+func TestShowETag(t *testing.T) {
+	movie := &data.Movie{ID: 1, Version: 3}
+	etag := showETag(movie, nil)
+	if !strings.HasPrefix(etag, `"3-`) {
+		t.Errorf("expected a strong etag starting with the version, got %s", etag)
+	}
+	if etag == showETag(movie, []string{"title"}) {
+		t.Error("expected a different field set to produce a new etag")
+	}
+	if etag != showETag(movie, nil) {
+		t.Error("expected the etag to be stable")
+	}
+}
+
+func TestShowETagIncludesCollection(t *testing.T) {
+	movie := &data.Movie{ID: 1, Version: 3}
+	etag := showETag(movie, nil)
+	movie.Collection = &data.MovieCollection{ID: 2, Name: "The Matrix", Position: 1}
+	moved := showETag(movie, nil)
+	if moved == etag {
+		t.Error("expected joining a collection to produce a new etag")
+	}
+	movie.Collection.Position = 2
+	if showETag(movie, nil) == moved {
+		t.Error("expected reordering a collection to produce a new etag")
+	}
+}
+
+func TestShowETagIncludesTags(t *testing.T) {
+	movie := &data.Movie{ID: 1, Version: 3, Tags: []data.TagCount{{Name: "heist", Count: 1}}}
+	etag := showETag(movie, nil)
+	movie.Tags[0].Count = 2
+	if showETag(movie, nil) == etag {
+		t.Error("expected changed tag counts to produce a new etag")
+	}
+}
+
+func TestShowETagIncludesTranslation(t *testing.T) {
+	movie := &data.Movie{ID: 1, Version: 3, Title: "The Matrix"}
+	original := showETag(movie, nil)
+	movie.Title, movie.Locale = "Matrice", "fr"
+	if showETag(movie, nil) == original {
+		t.Error("expected a translated movie to produce a new etag")
+	}
+}
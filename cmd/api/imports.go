@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/importer"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// importChunkSize is the number of rows written per transaction. Progress is
+// saved after every chunk, so an interrupted import resumes from there.
+const importChunkSize = 500
+
+func (app *application) createImportHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	imp := &data.Import{
+		Status:  data.ImportPending,
+		Format:  app.readString(qs, "format", importer.FormatCSV),
+		DryRun:  app.readBool(qs, "dry_run", false, v),
+		Mapping: make(map[string]string),
+	}
+	v.Check(validator.In(imp.Format, importer.Formats...), "format", "must be either csv or ndjson")
+	for _, pair := range app.readCSV(qs, "mapping", nil) {
+		column, field, ok := strings.Cut(pair, ":")
+		if !ok || column == "" || !validator.In(field, importer.Fields...) {
+			v.AddError("mapping", "must be a list of column:field pairs where field is one of "+strings.Join(importer.Fields, ", "))
+			break
+		}
+		imp.Mapping[column] = field
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	source, err := app.readFile(w, r, "file", app.config.imports.maxBytes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	rows, err := importer.Parse(imp.Format, source, imp.Mapping)
+	if err != nil {
+		v.AddError("file", err.Error())
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	imp.Source = source
+	imp.TotalRows = len(rows)
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		imp.UserID = &user.ID
+	}
+	err = app.models.Imports.Insert(imp)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The job updates imp as it goes, so it only starts once the response
+	// has been written.
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/imports/%d", imp.ID))
+	err = app.writeJson(w, http.StatusAccepted, envelope{"import": imp}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+	app.background(func() {
+		app.runImport(imp, rows)
+	})
+}
+
+func (app *application) showImportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	imp, err := app.models.Imports.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Imports are only visible to the user who started them and to admins.
+	user := app.contextGetUser(r)
+	if imp.UserID == nil || *imp.UserID != user.ID {
+		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include("movies:admin") {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"import": imp}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resumeImports restarts the imports that were interrupted by a shutdown.
+func (app *application) resumeImports() {
+	imports, err := app.models.Imports.GetUnfinished()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "resume imports"})
+		return
+	}
+	for _, imp := range imports {
+		app.background(func() {
+			rows, err := importer.Parse(imp.Format, imp.Source, imp.Mapping)
+			if err != nil {
+				imp.Status = data.ImportFailed
+				imp.AddError(0, map[string]string{"file": err.Error()})
+				app.saveImport(imp)
+				return
+			}
+			app.runImport(imp, rows)
+		})
+	}
+}
+
+// runImport processes the rows of imp from its last checkpoint. When the
+// server starts shutting down it stops between chunks and leaves the import
+// pending so that it is resumed on the next start.
+func (app *application) runImport(imp *data.Import, rows []importer.Row) {
+	imp.Status = data.ImportRunning
+	imp.TotalRows = len(rows)
+	if !app.saveImport(imp) {
+		return
+	}
+
+	for imp.ProcessedRows < len(rows) {
+		select {
+		case <-app.shutdown:
+			imp.Status = data.ImportPending
+			app.saveImport(imp)
+			return
+		default:
+		}
+
+		end := min(imp.ProcessedRows+importChunkSize, len(rows))
+		chunk := rows[imp.ProcessedRows:end]
+
+		// Work on a copy so a failed chunk leaves the counters untouched.
+		progress := *imp
+		progress.Errors = append([]data.ImportRowError(nil), imp.Errors...)
+		var err error
+		if imp.DryRun {
+			err = app.checkImportChunk(&progress, chunk)
+			if err == nil {
+				progress.ProcessedRows = end
+				err = app.models.Imports.UpdateProgress(&progress)
+			}
+		} else {
+			err = app.models.InTx(context.Background(), func(tx data.Models) error {
+				err := app.importChunk(tx, &progress, chunk)
+				if err != nil {
+					return err
+				}
+				progress.ProcessedRows = end
+				return tx.Imports.UpdateProgress(&progress)
+			})
+		}
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+			imp.Status = data.ImportFailed
+			app.saveImport(imp)
+			return
+		}
+		*imp = progress
+		if !imp.DryRun {
+			app.moviesChanged()
+		}
+	}
+
+	imp.Status = data.ImportCompleted
+	if app.saveImport(imp) {
+		app.logger.PrintInfo("import completed", map[string]string{
+			"import_id": strconv.FormatInt(imp.ID, 10),
+			"created":   strconv.Itoa(imp.Created),
+			"updated":   strconv.Itoa(imp.Updated),
+			"failed":    strconv.Itoa(imp.Failed),
+		})
+	}
+}
+
+func (app *application) saveImport(imp *data.Import) bool {
+	err := app.models.Imports.UpdateProgress(imp)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"import_id": strconv.FormatInt(imp.ID, 10)})
+		return false
+	}
+	return true
+}
+
+// validateImportRow returns the conversion and validation errors of row, or
+// nil if the movie it describes can be saved.
+func validateImportRow(row importer.Row, rules data.MovieRules) map[string]string {
+	if row.Errors != nil {
+		return row.Errors
+	}
+	v := validator.New()
+	data.ValidateMovie(v, &row.Movie, rules)
+	if !v.Valid() {
+		return v.Errors
+	}
+	return nil
+}
+
+// checkImportChunk validates a chunk of a dry run and counts which rows would
+// create or update a movie, without writing anything.
+func (app *application) checkImportChunk(imp *data.Import, rows []importer.Row) error {
+	var externalIDs []string
+	for _, row := range rows {
+		if row.ExternalID != "" {
+			externalIDs = append(externalIDs, row.ExternalID)
+		}
+	}
+	existing, err := app.models.Movies.ExistingExternalIDs(externalIDs)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if errs := validateImportRow(row, app.config.movieRules); errs != nil {
+			imp.AddError(row.Line, errs)
+			continue
+		}
+		if existing[row.ExternalID] {
+			imp.Updated++
+		} else {
+			imp.Created++
+			if row.ExternalID != "" {
+				existing[row.ExternalID] = true
+			}
+		}
+	}
+	return nil
+}
+
+// importChunk saves a chunk of rows, inserting new movies and updating the
+// ones whose external id is already known.
+func (app *application) importChunk(tx data.Models, imp *data.Import, rows []importer.Row) error {
+	var userID int64
+	if imp.UserID != nil {
+		userID = *imp.UserID
+	}
+	for _, row := range rows {
+		if errs := validateImportRow(row, app.config.movieRules); errs != nil {
+			imp.AddError(row.Line, errs)
+			continue
+		}
+
+		movie := row.Movie
+		movie.ExternalID = row.ExternalID
+		if movie.ExternalID == "" {
+			err := app.importInsert(tx, userID, &movie)
+			if err != nil {
+				return err
+			}
+			imp.Created++
+			continue
+		}
+
+		existing, err := tx.Movies.GetByExternalID(movie.ExternalID)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.importInsert(tx, userID, &movie)
+			if err != nil {
+				return err
+			}
+			imp.Created++
+		case err != nil:
+			return err
+		case existing.DeletedAt != nil:
+			imp.AddError(row.Line, map[string]string{"external_id": "belongs to a movie in the trash"})
+		default:
+			before := *existing
+			existing.Title = movie.Title
+			existing.Year = movie.Year
+			existing.Runtime = movie.Runtime
+			existing.Genres = movie.Genres
+			err = tx.Movies.Update(existing)
+			if err != nil {
+				return err
+			}
+			err = tx.Revisions.Insert(data.NewMovieRevision(data.RevisionUpdate, userID, &before, existing))
+			if err != nil {
+				return err
+			}
+			imp.Updated++
+		}
+	}
+	return nil
+}
+
+func (app *application) importInsert(tx data.Models, userID int64, movie *data.Movie) error {
+	err := tx.Movies.Insert(movie)
+	if err != nil {
+		return err
+	}
+	return tx.Revisions.Insert(data.NewMovieRevision(data.RevisionCreate, userID, nil, movie))
+}
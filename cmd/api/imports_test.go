@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"lightsaber.dkadev.xyz/internal/jsonlog"
+)
+
+func TestCreateImportHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		file    string
+		wantKey string
+	}{
+		{name: "unknown format", query: "?format=xml", file: "title\nMoana\n", wantKey: "format"},
+		{name: "bad dry run", query: "?dry_run=maybe", file: "title\nMoana\n", wantKey: "dry_run"},
+		{name: "bad mapping", query: "?mapping=Name:director", file: "title\nMoana\n", wantKey: "mapping"},
+		{name: "no title column", query: "", file: "name,year\nMoana,2016\n", wantKey: "file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff)}
+			app.config.imports.maxBytes = 1024
+
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			part, _ := mw.CreateFormFile("file", "movies.csv")
+			part.Write([]byte(tt.file))
+			mw.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/v1/imports"+tt.query, &body)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			w := httptest.NewRecorder()
+
+			app.createImportHandler(w, r)
+
+			if w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected status 422, got %d: %s", w.Code, w.Body)
+			}
+			var response struct {
+				Error map[string]string `json:"error"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := response.Error[tt.wantKey]; !ok {
+				t.Errorf("expected an error for %q, got %v", tt.wantKey, response.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/similarity"
+)
+
+// similarPerMovie is how many similar movies are stored for each movie.
+const similarPerMovie = 50
+
+// runPeriodic calls fn every interval in the background until the server
+// starts shutting down. A panic in fn is logged and the next run still happens.
+func (app *application) runPeriodic(interval time.Duration, fn func()) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				func() {
+					defer func() {
+						if err := recover(); err != nil {
+							app.logger.PrintError(fmt.Errorf("%s", err), nil)
+						}
+					}()
+					fn()
+				}()
+			case <-app.shutdown:
+				return
+			}
+		}
+	})
+}
+
+func (app *application) purgeTrash() {
+	movies, err := app.models.Movies.Purge(time.Now().Add(-app.config.trash.retention))
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "purge trash"})
+		return
+	}
+	for _, movie := range movies {
+		app.deletePosterObjects("purge trash", movie.PosterURL, movie.ThumbnailURL)
+	}
+	if len(movies) > 0 {
+		app.logger.PrintInfo("purged movies from trash", map[string]string{"count": strconv.Itoa(len(movies))})
+	}
+}
+
+// refreshSimilarities recomputes the similar movies of every movie and
+// replaces the stored table in one transaction.
+func (app *application) refreshSimilarities() {
+	start := time.Now()
+	movies, err := app.models.Movies.GetAllForSimilarity()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "refresh similarities"})
+		return
+	}
+	items := make([]similarity.Item, len(movies))
+	for i, movie := range movies {
+		items[i] = similarity.Item{ID: movie.ID, Year: movie.Year, Genres: movie.Genres}
+	}
+
+	var rows []data.MovieSimilarity
+	for id, matches := range similarity.TopK(items, similarPerMovie) {
+		for _, match := range matches {
+			rows = append(rows, data.MovieSimilarity{MovieID: id, SimilarID: match.ID, Score: match.Score})
+		}
+	}
+	err = app.models.InTx(context.Background(), func(tx data.Models) error {
+		return tx.Similarities.Replace(rows)
+	})
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "refresh similarities"})
+		return
+	}
+	app.logger.PrintInfo("refreshed similar movies", map[string]string{
+		"movies":   strconv.Itoa(len(movies)),
+		"pairs":    strconv.Itoa(len(rows)),
+		"duration": time.Since(start).String(),
+	})
+}
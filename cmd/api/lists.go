@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/julienschmidt/httprouter"
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	list := &data.List{
+		UserID:      app.contextGetUser(r).ID,
+		Title:       input.Title,
+		Description: input.Description,
+		Visibility:  input.Visibility,
+		Items:       []*data.ListItem{},
+	}
+	if list.Visibility == "" {
+		list.Visibility = data.ListPrivate
+	}
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Insert(list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%s", list.Slug))
+	err = app.writeJson(w, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readVisibleList(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	list.Items, err = app.models.Lists.GetItems(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Mine     bool
+		Followed bool
+		data.ListFilter
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Mine = app.readBool(qs, "mine", false, v)
+	input.Followed = app.readBool(qs, "followed", false, v)
+	input.OwnerID = int64(app.readInt(qs, "user", 0, v))
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-updated_at")
+	input.Filters.SortSafeList = []string{"id", "title", "created_at", "updated_at", "-id", "-title", "-created_at", "-updated_at"}
+
+	v.Check(!(input.Mine && input.OwnerID != 0), "user", "must not be used together with mine")
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if (input.Mine || input.Followed) && user.IsAnonymous() {
+		app.authenticationRequiredResponse(w, r)
+		return
+	}
+	if !user.IsAnonymous() {
+		input.ViewerID = user.ID
+	}
+	if input.Mine {
+		input.OwnerID = user.ID
+	}
+	if input.Followed {
+		input.FollowedBy = user.ID
+	}
+
+	lists, metadata, err := app.models.Lists.GetAll(input.ListFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"lists": lists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+		RotateSlug  bool    `json:"rotate_slug"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Title != nil {
+		list.Title = *input.Title
+	}
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+	if input.Visibility != nil {
+		list.Visibility = *input.Visibility
+	}
+	v := validator.New()
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Update(list, input.RotateSlug)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Lists.Delete(list.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "list successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieID int64  `json:"movie_id"`
+		Note    string `json:"note"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.MovieID > 0, "movie_id", "must be provided")
+	data.ValidateListItemNote(v, input.Note)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Movies in the trash can not be added.
+	_, err = app.models.Movies.Get(input.MovieID)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		err = data.ErrUnknownMovie
+	}
+
+	if err == nil {
+		err = app.models.InTx(r.Context(), func(tx data.Models) error {
+			err := tx.Lists.AddItem(list.ID, input.MovieID, input.Note)
+			if err != nil {
+				return err
+			}
+			return tx.Lists.Touch(list)
+		})
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownMovie):
+			app.failedValidationResponse(w, r, map[string]string{"movie_id": "must be an existing movie"})
+		case errors.Is(err, data.ErrDuplicateListItem):
+			app.failedValidationResponse(w, r, map[string]string{"movie_id": "is already on the list"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeListWithItems(w, r, http.StatusCreated, list)
+}
+
+func (app *application) removeListItemHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+	movieID, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.InTx(r.Context(), func(tx data.Models) error {
+		err := tx.Lists.RemoveItem(list.ID, movieID)
+		if err != nil {
+			return err
+		}
+		return tx.Lists.Touch(list)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeListWithItems(w, r, http.StatusOK, list)
+}
+
+func (app *application) reorderListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readOwnList(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movie_ids"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	items, err := app.models.Lists.GetItems(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	current := make([]int64, len(items))
+	for i, item := range items {
+		current[i] = item.MovieID
+	}
+	requested := slices.Clone(input.MovieIDs)
+	slices.Sort(current)
+	slices.Sort(requested)
+	v := validator.New()
+	v.Check(slices.Equal(current, requested), "movie_ids", "must contain every movie on the list exactly once")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.InTx(r.Context(), func(tx data.Models) error {
+		err := tx.Lists.Reorder(list.ID, input.MovieIDs)
+		if err != nil {
+			return err
+		}
+		return tx.Lists.Touch(list)
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeListWithItems(w, r, http.StatusOK, list)
+}
+
+func (app *application) followListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readVisibleList(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Lists.Follow(list.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "list followed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unfollowListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readVisibleList(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Lists.Unfollow(list.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "list unfollowed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readVisibleList loads the list named by the :slug parameter if the current
+// user may see it. Otherwise it sends a not found response, so that private
+// lists can not be told apart from missing ones, and returns false.
+func (app *application) readVisibleList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	var viewerID int64
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		viewerID = user.ID
+	}
+	slug := httprouter.ParamsFromContext(r.Context()).ByName("slug")
+	list, err := app.models.Lists.GetBySlug(slug, viewerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return list, true
+}
+
+// readOwnList is like readVisibleList but also requires the current user to
+// own the list.
+func (app *application) readOwnList(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+	list, ok := app.readVisibleList(w, r)
+	if !ok {
+		return nil, false
+	}
+	if list.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+	return list, true
+}
+
+func (app *application) writeListWithItems(w http.ResponseWriter, r *http.Request, status int, list *data.List) {
+	var err error
+	list.Items, err = app.models.Lists.GetItems(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	list.ItemCount = len(list.Items)
+	err = app.writeJson(w, status, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
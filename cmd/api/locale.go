@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// maxLocales bounds how many languages of an Accept-Language header are
+// considered.
+const maxLocales = 10
+
+// readLocales returns the locales to show movies in, most preferred first.
+// The lang query parameter takes precedence over the Accept-Language header.
+// Each locale with a region is followed by its bare language, so pt-BR falls
+// back to pt. An empty result means the original titles are shown.
+func (app *application) readLocales(r *http.Request, v *validator.Validator) []string {
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		locale := data.NormalizeLocale(lang)
+		v.Check(validator.Matches(locale, data.LocaleRX), "lang", "must be a language code such as fr or pt-BR")
+		return expandLocales([]string{locale})
+	}
+	return expandLocales(parseAcceptLanguage(r.Header.Get("Accept-Language")))
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language header
+// ordered by quality. Wildcards, refused languages and tags that are not
+// valid locales are left out; a malformed header is ignored rather than
+// rejected.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		locale := data.NormalizeLocale(tag)
+		if !validator.Matches(locale, data.LocaleRX) {
+			continue
+		}
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q <= 0 {
+			continue
+		}
+		tags = append(tags, weighted{locale, q})
+	}
+	slices.SortStableFunc(tags, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+
+	locales := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		locales = append(locales, tag.locale)
+	}
+	return locales
+}
+
+func expandLocales(locales []string) []string {
+	var expanded []string
+	for _, locale := range locales {
+		for _, candidate := range []string{locale, data.BaseLocale(locale)} {
+			if !slices.Contains(expanded, candidate) {
+				expanded = append(expanded, candidate)
+			}
+		}
+		if len(expanded) >= maxLocales {
+			return expanded[:maxLocales]
+		}
+	}
+	return expanded
+}
+
+// localizeMovies replaces the title and synopsis of movies with their best
+// translation for locales.
+func (app *application) localizeMovies(locales []string, movies []*data.Movie, ids []int64) error {
+	if len(locales) == 0 {
+		return nil
+	}
+	translations, err := app.models.Translations.ForMovies(ids, locales)
+	if err != nil {
+		return err
+	}
+	for _, movie := range movies {
+		t := data.BestTranslation(translations[movie.ID], locales)
+		if t == nil {
+			continue
+		}
+		movie.Title = t.Title
+		if t.Synopsis != "" {
+			movie.Synopsis = t.Synopsis
+		}
+		movie.Locale = t.Locale
+	}
+	return nil
+}
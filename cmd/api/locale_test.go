@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+func TestParseAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []string
+	}{
+		{"", []string{}},
+		{"fr", []string{"fr"}},
+		{"en-US,en;q=0.8,pt_br;q=0.9", []string{"en-US", "pt-BR", "en"}},
+		{"de;q=0.5, *;q=0.9, ja;q=0, es", []string{"es", "de"}},
+		{"fr;q=nope, it", []string{"it"}},
+		{"x-klingon, zh-Hant-TW", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := parseAcceptLanguage(tt.header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLocales(t *testing.T) {
+	app := &application{}
+
+	r := httptest.NewRequest("GET", "/v1/movies", nil)
+	r.Header.Set("Accept-Language", "pt-BR,en-GB;q=0.7,pt;q=0.5")
+	v := validator.New()
+	want := []string{"pt-BR", "pt", "en-GB", "en"}
+	if got := app.readLocales(r, v); !reflect.DeepEqual(got, want) || !v.Valid() {
+		t.Errorf("got %v (%v), want %v", got, v.Errors, want)
+	}
+
+	r = httptest.NewRequest("GET", "/v1/movies?lang=FR_ca", nil)
+	r.Header.Set("Accept-Language", "de")
+	want = []string{"fr-CA", "fr"}
+	if got := app.readLocales(r, v); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected lang to win over the header, got %v", got)
+	}
+
+	r = httptest.NewRequest("GET", "/v1/movies?lang=french", nil)
+	app.readLocales(r, v)
+	if _, ok := v.Errors["lang"]; !ok {
+		t.Error("expected an invalid lang to be rejected")
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
@@ -11,13 +12,17 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/joho/godotenv"
+	"lightsaber.dkadev.xyz/internal/cache"
 	"lightsaber.dkadev.xyz/internal/data"
 	"lightsaber.dkadev.xyz/internal/jsonlog"
 	"lightsaber.dkadev.xyz/internal/mailer"
 	"lightsaber.dkadev.xyz/internal/metrics"
+	"lightsaber.dkadev.xyz/internal/storage"
+	"lightsaber.dkadev.xyz/internal/validator"
 
 	_ "github.com/lib/pq"
 )
@@ -28,9 +33,10 @@ var (
 )
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port           int
+	env            string
+	requireIfMatch bool
+	db             struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -51,6 +57,40 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	storage struct {
+		backend  string
+		localDir string
+		localURL string
+		s3       struct {
+			endpoint  string
+			bucket    string
+			region    string
+			accessKey string
+			secretKey string
+			publicURL string
+		}
+	}
+	posters struct {
+		maxBytes      int64
+		thumbnailSize int
+	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	imports struct {
+		maxBytes int64
+	}
+	suggest struct {
+		cacheSize int
+	}
+	similar struct {
+		refreshInterval time.Duration
+	}
+	stats struct {
+		cacheTTL time.Duration
+	}
+	movieRules data.MovieRules
 }
 
 type application struct {
@@ -59,7 +99,13 @@ type application struct {
 	models        data.Models
 	mailer        mailer.Mailer
 	metricsClient *metrics.Client
-	wg            sync.WaitGroup
+	storage       storage.Storage
+	suggestions   *cache.LRU[string, cachedSuggestions]
+	stats         *cache.TTL[int, cachedStats]
+	// moviesGeneration counts the writes to movies, see moviesChanged.
+	moviesGeneration atomic.Int64
+	shutdown         chan struct{}
+	wg               sync.WaitGroup
 }
 
 func main() {
@@ -72,6 +118,23 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.StringVar(&cfg.storage.backend, "storage-backend", "local", "Upload storage backend (local|s3)")
+	flag.StringVar(&cfg.storage.localDir, "storage-local-dir", "./uploads", "Directory for the local storage backend")
+	flag.StringVar(&cfg.storage.localURL, "storage-local-url", "/v1/uploads", "Base URL the local storage backend is served from")
+	flag.Int64Var(&cfg.posters.maxBytes, "poster-max-bytes", 10_485_760, "Maximum poster upload size in bytes")
+	flag.IntVar(&cfg.posters.thumbnailSize, "poster-thumbnail-size", 300, "Maximum width and height of poster thumbnails")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted movies stay in the trash before being purged")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often to purge expired movies from the trash (0 disables)")
+	flag.Int64Var(&cfg.imports.maxBytes, "import-max-bytes", 52_428_800, "Maximum catalogue import file size in bytes")
+	flag.IntVar(&cfg.suggest.cacheSize, "suggest-cache-size", 10_000, "Number of title suggestion results to cache (0 disables)")
+	flag.DurationVar(&cfg.similar.refreshInterval, "similar-refresh-interval", 6*time.Hour, "How often to recompute similar movies (0 disables)")
+	flag.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", time.Minute, "How long catalogue statistics are cached (0 disables)")
+	flag.IntVar(&cfg.movieRules.MaxTitleBytes, "movie-max-title-bytes", data.DefaultMovieRules.MaxTitleBytes, "Maximum movie title length in bytes")
+	flag.IntVar(&cfg.movieRules.MinGenres, "movie-min-genres", data.DefaultMovieRules.MinGenres, "Minimum number of genres per movie")
+	flag.IntVar(&cfg.movieRules.MaxGenres, "movie-max-genres", data.DefaultMovieRules.MaxGenres, "Maximum number of genres per movie")
+	flag.IntVar(&cfg.movieRules.MinYear, "movie-min-year", data.DefaultMovieRules.MinYear, "Earliest movie release year")
+	flag.IntVar(&cfg.movieRules.MaxFutureYears, "movie-max-future-years", data.DefaultMovieRules.MaxFutureYears, "How many years ahead announced releases may be dated")
+	flag.BoolVar(&cfg.requireIfMatch, "require-if-match", false, "Reject movie updates and deletes without an If-Match header")
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 	flag.Parse()
 	if *displayVersion {
@@ -82,6 +145,11 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	v := validator.New()
+	if data.ValidateMovieRules(v, cfg.movieRules); !v.Valid() {
+		logger.PrintFatal(errors.New("invalid movie validation rules"), v.Errors)
+	}
+
 	err := godotenv.Load(".env")
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -96,6 +164,12 @@ func main() {
 	cfg.smtp.sender = os.Getenv("SENDER")
 	cfg.smtp.password = os.Getenv("PASSWORD")
 	cfg.cors.trustedOrigins = strings.Split(os.Getenv("TRUSTED_ORIGINS"), ",")
+	cfg.storage.s3.endpoint = os.Getenv("S3_ENDPOINT")
+	cfg.storage.s3.bucket = os.Getenv("S3_BUCKET")
+	cfg.storage.s3.region = os.Getenv("S3_REGION")
+	cfg.storage.s3.accessKey = os.Getenv("S3_ACCESS_KEY")
+	cfg.storage.s3.secretKey = os.Getenv("S3_SECRET_KEY")
+	cfg.storage.s3.publicURL = os.Getenv("S3_PUBLIC_URL")
 
 	db, err := openDB(cfg)
 	if err != nil {
@@ -122,14 +196,32 @@ func main() {
 		metricsClient = nil // Continue without metrics if Graphite is not available
 	}
 
+	store, err := openStorage(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := &application{
 		config:        cfg,
 		logger:        logger,
 		models:        data.NewModels(db),
 		mailer:        mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
 		metricsClient: metricsClient,
+		storage:       store,
+		suggestions:   cache.NewLRU[string, cachedSuggestions](cfg.suggest.cacheSize),
+		stats:         cache.NewTTL[int, cachedStats](cfg.stats.cacheTTL),
+		shutdown:      make(chan struct{}),
 	}
 
+	if cfg.trash.purgeInterval > 0 {
+		app.runPeriodic(cfg.trash.purgeInterval, app.purgeTrash)
+	}
+	if cfg.similar.refreshInterval > 0 {
+		app.background(app.refreshSimilarities)
+		app.runPeriodic(cfg.similar.refreshInterval, app.refreshSimilarities)
+	}
+	app.resumeImports()
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -160,3 +252,21 @@ func openDB(cfg config) (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+func openStorage(cfg config) (storage.Storage, error) {
+	switch cfg.storage.backend {
+	case "local":
+		return storage.NewLocal(cfg.storage.localDir, cfg.storage.localURL)
+	case "s3":
+		s3 := cfg.storage.s3
+		if s3.endpoint == "" || s3.bucket == "" {
+			return nil, errors.New("S3_ENDPOINT and S3_BUCKET must be set for the s3 storage backend")
+		}
+		if s3.region == "" {
+			s3.region = "us-east-1"
+		}
+		return storage.NewS3(s3.endpoint, s3.bucket, s3.region, s3.accessKey, s3.secretKey, s3.publicURL), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.storage.backend)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// maxMergeDuplicates caps the number of movies merged by one request.
+const maxMergeDuplicates = 20
+
+// errMissingDuplicate is returned inside the merge transaction when one of the
+// duplicates does not exist or is in the trash.
+var errMissingDuplicate = errors.New("missing duplicate")
+
+func (app *application) listDuplicateMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	opts := data.DuplicateOptions{
+		Threshold:        app.readFloat(qs, "threshold", 0.8, v),
+		YearTolerance:    app.readInt(qs, "year_tolerance", 1, v),
+		RuntimeTolerance: app.readInt(qs, "runtime_tolerance", 5, v),
+	}
+	limit := app.readInt(qs, "limit", 50, v)
+
+	v.Check(opts.Threshold > 0 && opts.Threshold <= 1, "threshold", "must be greater than 0 and at most 1")
+	v.Check(opts.YearTolerance >= 0 && opts.YearTolerance <= 5, "year_tolerance", "must be between 0 and 5")
+	v.Check(opts.RuntimeTolerance >= 0 && opts.RuntimeTolerance <= 60, "runtime_tolerance", "must be between 0 and 60")
+	v.Check(limit > 0 && limit <= 500, "limit", "must be between 1 and 500")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	duplicates, total, err := app.models.Movies.FindDuplicates(opts, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"duplicates": duplicates, "total": total}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) mergeMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		SurvivorID   int64   `json:"survivor_id"`
+		DuplicateIDs []int64 `json:"duplicate_ids"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.SurvivorID > 0, "survivor_id", "must be provided")
+	v.Check(len(input.DuplicateIDs) > 0, "duplicate_ids", "must contain at least 1 id")
+	v.Check(len(input.DuplicateIDs) <= maxMergeDuplicates, "duplicate_ids", fmt.Sprintf("must not contain more than %d ids", maxMergeDuplicates))
+	v.Check(validator.Unique(input.DuplicateIDs), "duplicate_ids", "must not contain duplicate values")
+	v.Check(!slices.Contains(input.DuplicateIDs, input.SurvivorID), "duplicate_ids", "must not contain survivor_id")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	survivor, err := app.models.Movies.Get(input.SurvivorID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"survivor_id": "must be an existing movie"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *survivor
+
+	var userID int64
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		userID = user.ID
+	}
+	err = app.models.InTx(r.Context(), func(tx data.Models) error {
+		// The duplicates are read and locked inside the transaction, so the
+		// fields merged into the survivor come from the rows being deleted.
+		duplicates, err := tx.Movies.GetForMerge(input.DuplicateIDs)
+		if err != nil {
+			return err
+		}
+		for _, id := range input.DuplicateIDs {
+			duplicate, ok := duplicates[id]
+			if !ok {
+				return errMissingDuplicate
+			}
+			mergeMovieFields(survivor, duplicate, app.config.movieRules.MaxGenres)
+		}
+		for _, id := range input.DuplicateIDs {
+			err := tx.Movies.MergeInto(survivor.ID, id)
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Movies.Update(survivor)
+		if err != nil {
+			return err
+		}
+		return tx.Revisions.Insert(data.NewMovieRevision(data.RevisionUpdate, userID, &before, survivor))
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errMissingDuplicate):
+			app.failedValidationResponse(w, r, map[string]string{"duplicate_ids": "must only contain existing movies"})
+		case errors.Is(err, data.ErrRecordNotFound), errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.moviesChanged()
+
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": survivor, "merged_ids": input.DuplicateIDs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeMovieFields completes survivor with what duplicate knows and survivor
+// does not: genres are combined, up to maxGenres, and an
+// empty runtime, synopsis or poster is taken from the duplicate.
+func mergeMovieFields(survivor, duplicate *data.Movie, maxGenres int) {
+	for _, genre := range duplicate.Genres {
+		if len(survivor.Genres) >= maxGenres {
+			break
+		}
+		if !slices.Contains(survivor.Genres, genre) {
+			survivor.Genres = append(survivor.Genres, genre)
+		}
+	}
+	if survivor.Runtime == 0 {
+		survivor.Runtime = duplicate.Runtime
+	}
+	if survivor.Synopsis == "" {
+		survivor.Synopsis = duplicate.Synopsis
+	}
+	if survivor.PosterURL == "" {
+		survivor.PosterURL = duplicate.PosterURL
+		survivor.ThumbnailURL = duplicate.ThumbnailURL
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"lightsaber.dkadev.xyz/internal/data"
+)
+
+func TestMergeMovieFields(t *testing.T) {
+	survivor := &data.Movie{ID: 1, Title: "The Matrix", Year: 1999, Genres: []string{"action", "sci-fi"}}
+	duplicate := &data.Movie{
+		ID:           2,
+		Title:        "Matrix",
+		Year:         1999,
+		Runtime:      136,
+		Genres:       []string{"sci-fi", "cyberpunk"},
+		Synopsis:     "A hacker learns the truth.",
+		PosterURL:    "/posters/2.jpg",
+		ThumbnailURL: "/posters/2-thumb.jpg",
+	}
+	mergeMovieFields(survivor, duplicate, data.DefaultMovieRules.MaxGenres)
+
+	if !reflect.DeepEqual(survivor.Genres, []string{"action", "sci-fi", "cyberpunk"}) {
+		t.Errorf("unexpected genres %v", survivor.Genres)
+	}
+	if survivor.Title != "The Matrix" || survivor.Runtime != 136 || survivor.Synopsis != duplicate.Synopsis {
+		t.Errorf("expected only missing fields to be filled, got %+v", survivor)
+	}
+	if survivor.PosterURL != duplicate.PosterURL || survivor.ThumbnailURL != duplicate.ThumbnailURL {
+		t.Errorf("expected the poster to be taken over, got %q %q", survivor.PosterURL, survivor.ThumbnailURL)
+	}
+
+	other := &data.Movie{Runtime: 140, Synopsis: "Other", PosterURL: "/posters/3.jpg", Genres: []string{"a", "b", "c", "d"}}
+	mergeMovieFields(survivor, other, data.DefaultMovieRules.MaxGenres)
+	if survivor.Runtime != 136 || survivor.Synopsis != duplicate.Synopsis || survivor.PosterURL != duplicate.PosterURL {
+		t.Errorf("expected existing fields to be kept, got %+v", survivor)
+	}
+	if len(survivor.Genres) != data.DefaultMovieRules.MaxGenres {
+		t.Errorf("expected genres to be capped at %d, got %v", data.DefaultMovieRules.MaxGenres, survivor.Genres)
+	}
+}
@@ -3,7 +3,13 @@ package main
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"lightsaber.dkadev.xyz/internal/data"
 	"lightsaber.dkadev.xyz/internal/validator"
@@ -11,10 +17,11 @@ import (
 
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
+		Title    string       `json:"title"`
+		Year     int32        `json:"year"`
+		Runtime  data.Runtime `json:"runtime"`
+		Genres   []string     `json:"genres"`
+		Synopsis string       `json:"synopsis"`
 	}
 	err := app.readJson(w, r, &input)
 	if err != nil {
@@ -22,25 +29,29 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: int32(input.Runtime),
-		Genres:  input.Genres,
+		Title:    input.Title,
+		Year:     input.Year,
+		Runtime:  int32(input.Runtime),
+		Genres:   input.Genres,
+		Synopsis: input.Synopsis,
 	}
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, app.config.movieRules); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Insert(movie)
+	err = app.writeMovie(r, data.RevisionCreate, nil, movie, func(tx data.Models) error {
+		return tx.Movies.Insert(movie)
+	})
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/movies/%d", movie.ID))
+	headers.Set("ETag", movieETag(movie))
 
 	err = app.writeJson(w, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
@@ -52,8 +63,16 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 	id, err := app.readIdParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
+		return
 	}
-	movie, err := app.models.Movies.Get(id)
+	v := validator.New()
+	fields := app.readFields(r.URL.Query(), v)
+	locales := app.readLocales(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	movie, err := app.models.Movies.GetFields(id, fields)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -63,8 +82,26 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+	err = app.attachMovieDetails(locales, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Language")
 
-	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
+	etag := showETag(movie, fields)
+	if app.notModified(w, r, etag) {
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	body, err := sparseMovie(movie, fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": body}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -74,6 +111,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	id, err := app.readIdParam(r)
 	if err != nil {
 		app.notFoundResponse(w, r)
+		return
 	}
 	movie, err := app.models.Movies.Get(id)
 	if err != nil {
@@ -85,37 +123,62 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
-	}
-	err = app.readJson(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
+	if !app.checkIfMatch(w, r, movieETag(movie)) {
 		return
 	}
-	if input.Title != nil {
-		movie.Title = *input.Title
-	}
-	if input.Year != nil {
-		movie.Year = *input.Year
-	}
-	if input.Runtime != nil {
-		movie.Runtime = int32(*input.Runtime)
-	}
-	if input.Genres != nil {
-		movie.Genres = input.Genres
-	}
+	before := *movie
 	v := validator.New()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case mergePatchMediaType, jsonPatchMediaType:
+		err = app.patchMovie(w, r, mediaType, movie, v)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+	default:
+		var input struct {
+			Title    *string       `json:"title"`
+			Year     *int32        `json:"year"`
+			Runtime  *data.Runtime `json:"runtime"`
+			Genres   []string      `json:"genres"`
+			Synopsis *string       `json:"synopsis"`
+		}
+		err = app.readJson(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		if input.Title != nil {
+			movie.Title = *input.Title
+		}
+		if input.Year != nil {
+			movie.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			movie.Runtime = int32(*input.Runtime)
+		}
+		if input.Genres != nil {
+			movie.Genres = input.Genres
+		}
+		if input.Synopsis != nil {
+			movie.Synopsis = *input.Synopsis
+		}
+	}
+
+	if data.ValidateMovie(v, movie, app.config.movieRules); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = app.models.Movies.Update(movie)
+	err = app.writeMovie(r, data.RevisionUpdate, &before, movie, func(tx data.Models) error {
+		return tx.Movies.Update(movie)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -125,8 +188,10 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
+	headers := make(http.Header)
+	headers.Set("ETag", movieETag(movie))
 
-	err = app.writeJson(w, http.StatusCreated, envelope{"movie": movie}, nil)
+	err = app.writeJson(w, http.StatusCreated, envelope{"movie": movie}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -138,7 +203,7 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.notFoundResponse(w, r)
 		return
 	}
-	err = app.models.Movies.Delete(id)
+	movie, err := app.models.Movies.Get(id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -148,7 +213,24 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	err = app.writeJson(w, http.StatusOK, envelope{"message": "movie successfully deleted"}, nil)
+	if !app.checkIfMatch(w, r, movieETag(movie)) {
+		return
+	}
+	before := *movie
+	err = app.writeMovie(r, data.RevisionDelete, &before, movie, func(tx data.Models) error {
+		return tx.Movies.Delete(movie)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "movie successfully moved to trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -156,25 +238,102 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 
 func (app *application) listMovieHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieFilter
 		data.Filters
+		Facets []string
 	}
 
 	v := validator.New()
 	qs := r.URL.Query()
-	input.Title = app.readString(qs, "title", "")
+	input.MovieFilter = app.readMovieFilter(qs, v)
+	input.Facets = app.readCSV(qs, "facets", nil)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	input.Genres = app.readCSV(qs, "genres", []string{})
-	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-year", "-runtime", "-title"}
+	defaultSort := "id"
+	if input.Search != "" {
+		defaultSort = "relevance"
+	}
+	input.Filters.Sort = app.readString(qs, "sort", defaultSort)
+	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-year", "-runtime", "-title", "relevance"}
+	// Passing cursor (even empty, for the first page) selects keyset
+	// pagination instead of page numbers.
+	input.Filters.UseCursor = qs.Has("cursor")
+	input.Filters.Cursor = qs.Get("cursor")
+	input.Filters.SkipCount = !app.readBool(qs, "count", true, v)
+	input.Filters.Fields = app.readFields(qs, v)
+	input.MovieFilter.Locales = app.readLocales(r, v)
 
+	data.ValidateMovieFilter(v, input.MovieFilter)
+	if slices.Contains(strings.Split(input.Filters.Sort, ","), "relevance") {
+		v.Check(input.Search != "", "sort", "relevance can only be used together with q")
+		v.Check(!input.Filters.UseCursor, "sort", "relevance can not be used with cursor pagination")
+	}
+	for _, facet := range input.Facets {
+		v.Check(validator.In(facet, data.Facets...), "facets", "must be a list of genres or decade")
+	}
+	v.Check(validator.Unique(input.Facets), "facets", "must not contain duplicate values")
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.attachMovieDetails(input.Locales, movies...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	w.Header().Add("Vary", "Accept-Language")
+
+	body, err := sparseMovies(movies, input.Filters.Fields)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	env := envelope{"movies": body, "metadata": metadata}
+	var facets map[string][]data.FacetCount
+	if len(input.Facets) > 0 {
+		facets, err = app.models.Movies.Facets(input.MovieFilter, input.Facets)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		env["facets"] = facets
+	}
+
+	etag := listETag(movies, metadata, facets, input.Filters.Fields)
+	if app.notModified(w, r, etag) {
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJson(w, http.StatusOK, env, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listDeletedMovieHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafeList = []string{"id", "title", "deleted_at", "-id", "-title", "-deleted_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	movies, metadata, err := app.models.Movies.GetAllDeleted(input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -185,3 +344,105 @@ func (app *application) listMovieHandler(w http.ResponseWriter, r *http.Request)
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) restoreMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	movie, err := app.models.Movies.GetDeleted(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	before := *movie
+	err = app.writeMovie(r, data.RevisionRestore, &before, movie, func(tx data.Models) error {
+		return tx.Movies.Restore(movie)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieFilter reads the filters shared by the movie listing and export.
+func (app *application) readMovieFilter(qs url.Values, v *validator.Validator) data.MovieFilter {
+	filter := data.MovieFilter{
+		Search:     app.readString(qs, "q", ""),
+		Title:      app.readString(qs, "title", ""),
+		Genres:     app.readCSV(qs, "genres", []string{}),
+		GenresAny:  app.readCSV(qs, "genres_any", []string{}),
+		GenresNone: app.readCSV(qs, "genres_none", []string{}),
+		YearMin:    app.readInt(qs, "year_min", 0, v),
+		YearMax:    app.readInt(qs, "year_max", 0, v),
+		RuntimeMin: app.readInt(qs, "runtime_min", 0, v),
+		RuntimeMax: app.readInt(qs, "runtime_max", 0, v),
+	}
+	filter.CollectionID = int64(app.readInt(qs, "collection", 0, v))
+	filter.AvailableIn = data.NormalizeRegion(qs.Get("available_in"))
+	filter.Provider = data.NormalizeProvider(qs.Get("provider"))
+	for _, tag := range app.readCSV(qs, "tags", nil) {
+		filter.Tags = append(filter.Tags, data.NormalizeTag(tag))
+	}
+	if s := qs.Get("created_after"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			v.AddError("created_after", "must be an RFC 3339 timestamp")
+		}
+		filter.CreatedAfter = t
+	}
+	for _, s := range app.readCSV(qs, "ids", nil) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			v.AddError("ids", "must be a comma-separated list of integers")
+			break
+		}
+		filter.IDs = append(filter.IDs, id)
+	}
+	return filter
+}
+
+// attachMovieDetails localizes movies and sets their collection and tags,
+// which are not stored on the movie itself.
+func (app *application) attachMovieDetails(locales []string, movies ...*data.Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(movies))
+	for i, movie := range movies {
+		ids[i] = movie.ID
+	}
+	err := app.localizeMovies(locales, movies, ids)
+	if err != nil {
+		return err
+	}
+	collections, err := app.models.Collections.GetForMovies(ids)
+	if err != nil {
+		return err
+	}
+	tags, err := app.models.Tags.CountsForMovies(ids)
+	if err != nil {
+		return err
+	}
+	for _, movie := range movies {
+		movie.Collection = collections[movie.ID]
+		movie.Tags = tags[movie.ID]
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/jsonlog"
+)
+
+// TestShowETagAllowsUpdate fetches a movie and then updates it with the ETag
+// of the GET response as If-Match. It needs a migrated database in
+// TEST_DATABASE_URL.
+func TestShowETagAllowsUpdate(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff), models: data.NewModels(db)}
+	app.config.movieRules = data.DefaultMovieRules
+	app.config.requireIfMatch = true
+
+	movie := &data.Movie{Title: "ETag Test", Year: 1999, Runtime: 136, Genres: []string{"sci-fi"}}
+	if err := app.models.Movies.Insert(movie); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`DELETE FROM movies WHERE id = $1`, movie.ID)
+
+	request := func(method, body string) *http.Request {
+		r := httptest.NewRequest(method, "/v1/movies/"+strconv.FormatInt(movie.ID, 10), strings.NewReader(body))
+		params := httprouter.Params{{Key: "id", Value: strconv.FormatInt(movie.ID, 10)}}
+		r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+		return app.contextSetUser(r, data.AnonymousUser)
+	}
+
+	w := httptest.NewRecorder()
+	app.showMovieHandler(w, request(http.MethodGet, ""))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected an ETag with status 200, got %d %q", w.Code, etag)
+	}
+
+	r := request(http.MethodPatch, `{"title":"ETag Test 2"}`)
+	r.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	app.updateMovieHandler(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", w.Code, w.Body)
+	}
+
+	// The movie has moved on, so the same ETag is now stale.
+	r = request(http.MethodPatch, `{"title":"ETag Test 3"}`)
+	r.Header.Set("If-Match", etag)
+	w = httptest.NewRecorder()
+	app.updateMovieHandler(w, r)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status 412, got %d: %s", w.Code, w.Body)
+	}
+}
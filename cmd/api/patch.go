@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/jsonpatch"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+const (
+	mergePatchMediaType = "application/merge-patch+json"
+	jsonPatchMediaType  = "application/json-patch+json"
+)
+
+// moviePatchDocument is the document that merge patches and JSON patches are
+// applied against. It uses the same field names and runtime format as the
+// movie JSON returned by the API.
+type moviePatchDocument struct {
+	Title     string       `json:"title,omitempty"`
+	Year      int32        `json:"year,omitempty"`
+	Runtime   data.Runtime `json:"runtime,omitempty"`
+	Genres    []string     `json:"genres,omitempty"`
+	Synopsis  string       `json:"synopsis,omitempty"`
+	PosterURL string       `json:"poster_url,omitempty"`
+}
+
+// patchMovie applies a merge patch or JSON patch request body to movie. A
+// returned error means the body could not be read at all, while problems with
+// the patch itself or the document it produces are added to v.
+func (app *application) patchMovie(w http.ResponseWriter, r *http.Request, mediaType string, movie *data.Movie, v *validator.Validator) error {
+	var patch json.RawMessage
+	err := app.readJson(w, r, &patch)
+	if err != nil {
+		return err
+	}
+
+	doc, err := json.Marshal(moviePatchDocument{
+		Title:     movie.Title,
+		Year:      movie.Year,
+		Runtime:   data.Runtime(movie.Runtime),
+		Genres:    movie.Genres,
+		Synopsis:  movie.Synopsis,
+		PosterURL: movie.PosterURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case mergePatchMediaType:
+		doc, err = jsonpatch.MergePatch(doc, patch)
+	case jsonPatchMediaType:
+		doc, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		var opErr *jsonpatch.OperationError
+		if errors.As(err, &opErr) {
+			key := opErr.Path
+			if key == "" {
+				key = "patch"
+			}
+			v.AddError(key, fmt.Sprintf("operation %d (%s): %v", opErr.Index, opErr.Op, opErr.Err))
+			return nil
+		}
+		return err
+	}
+
+	var result moviePatchDocument
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&result)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			v.AddError("runtime", `must be in the format "<minutes> mins"`)
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			v.AddError(unmarshalTypeError.Field, "has an incorrect JSON type")
+		case errors.As(err, &unmarshalTypeError):
+			v.AddError("patch", "must produce a JSON object")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+			v.AddError(field, "is not a movie field")
+		default:
+			return err
+		}
+		return nil
+	}
+
+	movie.Title = result.Title
+	movie.Year = result.Year
+	movie.Runtime = int32(result.Runtime)
+	movie.Genres = result.Genres
+	movie.Synopsis = result.Synopsis
+
+	// Posters are uploaded separately, so a patch can only remove one.
+	switch result.PosterURL {
+	case "":
+		movie.PosterURL = ""
+		movie.ThumbnailURL = ""
+	case movie.PosterURL:
+	default:
+		v.AddError("poster_url", "can only be removed, upload a new poster with PUT /v1/movies/:id/poster")
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/jsonlog"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+func TestPatchMovie(t *testing.T) {
+	tests := []struct {
+		name      string
+		mediaType string
+		body      string
+		check     func(t *testing.T, movie *data.Movie)
+		wantError string
+	}{
+		{
+			name:      "merge patch replaces fields",
+			mediaType: mergePatchMediaType,
+			body:      `{"title":"Moana 2","runtime":"100 mins"}`,
+			check: func(t *testing.T, movie *data.Movie) {
+				if movie.Title != "Moana 2" || movie.Runtime != 100 || movie.Year != 2016 {
+					t.Errorf("unexpected movie %+v", movie)
+				}
+			},
+		},
+		{
+			name:      "merge patch removes poster",
+			mediaType: mergePatchMediaType,
+			body:      `{"poster_url":null}`,
+			check: func(t *testing.T, movie *data.Movie) {
+				if movie.PosterURL != "" || movie.ThumbnailURL != "" {
+					t.Errorf("expected poster to be cleared, got %+v", movie)
+				}
+			},
+		},
+		{
+			name:      "json patch appends genre",
+			mediaType: jsonPatchMediaType,
+			body:      `[{"op":"test","path":"/genres/0","value":"animation"},{"op":"add","path":"/genres/-","value":"family"}]`,
+			check: func(t *testing.T, movie *data.Movie) {
+				if !slices.Equal(movie.Genres, []string{"animation", "adventure", "family"}) {
+					t.Errorf("unexpected genres %v", movie.Genres)
+				}
+			},
+		},
+		{
+			name:      "json patch invalid path",
+			mediaType: jsonPatchMediaType,
+			body:      `[{"op":"remove","path":"/genres/7"}]`,
+			wantError: "/genres/7",
+		},
+		{
+			name:      "unknown field",
+			mediaType: mergePatchMediaType,
+			body:      `{"director":"Ron Clements"}`,
+			wantError: "director",
+		},
+		{
+			name:      "bad runtime",
+			mediaType: jsonPatchMediaType,
+			body:      `[{"op":"replace","path":"/runtime","value":"long"}]`,
+			wantError: "runtime",
+		},
+		{
+			name:      "poster cannot be set",
+			mediaType: mergePatchMediaType,
+			body:      `{"poster_url":"http://example.com/other.png"}`,
+			wantError: "poster_url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff)}
+			movie := &data.Movie{
+				ID:           1,
+				Title:        "Moana",
+				Year:         2016,
+				Runtime:      107,
+				Genres:       []string{"animation", "adventure"},
+				PosterURL:    "/v1/uploads/posters/1/poster",
+				ThumbnailURL: "/v1/uploads/posters/1/thumbnail.jpg",
+				Version:      1,
+			}
+
+			r := httptest.NewRequest(http.MethodPatch, "/v1/movies/1", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.mediaType)
+			v := validator.New()
+
+			err := app.patchMovie(httptest.NewRecorder(), r, tt.mediaType, movie, v)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantError != "" {
+				if _, ok := v.Errors[tt.wantError]; !ok {
+					t.Errorf("expected error for %q, got %v", tt.wantError, v.Errors)
+				}
+				return
+			}
+			if !v.Valid() {
+				t.Fatalf("unexpected validation errors %v", v.Errors)
+			}
+			tt.check(t, movie)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/thumbnail"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// maxPosterDimension bounds the width and height of uploaded posters. Images
+// are decoded in full, so this caps the memory a single upload can take at
+// about 64MB.
+const maxPosterDimension = 4_000
+
+var posterContentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// posterKeys returns the storage keys of a poster and its thumbnail. The keys
+// include a hash of the poster, so a new upload never overwrites the images
+// the movie currently points at and cached copies are never stale.
+func posterKeys(movieID int64, poster []byte) (posterKey, thumbKey string) {
+	sum := sha256.Sum256(poster)
+	prefix := fmt.Sprintf("posters/%d/%s", movieID, hex.EncodeToString(sum[:8]))
+	return prefix + "/poster", prefix + "/thumbnail.jpg"
+}
+
+// deletePosterObjects removes the stored objects behind the given poster URLs.
+// Failures are only logged: a leftover object wastes space but breaks nothing.
+func (app *application) deletePosterObjects(job string, urls ...string) {
+	for _, url := range urls {
+		key, ok := strings.CutPrefix(url, app.storage.URL(""))
+		if url == "" || !ok {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := app.storage.Delete(ctx, key)
+		cancel()
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"job": job, "key": key})
+		}
+	}
+}
+
+func (app *application) uploadMoviePosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	poster, err := app.readFile(w, r, "poster", app.config.posters.maxBytes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Never trust the client supplied Content-Type, sniff the bytes instead.
+	contentType := http.DetectContentType(poster)
+	v := validator.New()
+	v.Check(validator.In(contentType, posterContentTypes...), "poster", "must be a JPEG, PNG or GIF image")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Check the dimensions before decoding so a small file can't make us
+	// allocate a huge image.
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(poster))
+	if err != nil {
+		v.AddError("poster", "must be a valid image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	v.Check(cfg.Width <= maxPosterDimension && cfg.Height <= maxPosterDimension, "poster",
+		fmt.Sprintf("must not be larger than %dx%d pixels", maxPosterDimension, maxPosterDimension))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(poster))
+	if err != nil {
+		v.AddError("poster", "must be a valid image")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	thumb, err := thumbnail.JPEG(img, app.config.posters.thumbnailSize)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	posterKey, thumbKey := posterKeys(movie.ID, poster)
+
+	err = app.storage.Put(r.Context(), posterKey, poster, contentType)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.storage.Put(r.Context(), thumbKey, thumb, "image/jpeg")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	before := *movie
+	movie.PosterURL = app.storage.URL(posterKey)
+	movie.ThumbnailURL = app.storage.URL(thumbKey)
+
+	err = app.writeMovie(r, data.RevisionUpdate, &before, movie, func(tx data.Models) error {
+		return tx.Movies.Update(movie)
+	})
+	if err != nil {
+		// The movie still points at its old images, so drop the new ones
+		// unless they are the very same objects.
+		app.deletePosterObjects("upload poster", stalePosterURLs(&before, movie)...)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.deletePosterObjects("upload poster", stalePosterURLs(movie, &before)...)
+
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// stalePosterURLs returns the poster URLs of old that current no longer uses.
+func stalePosterURLs(current, old *data.Movie) []string {
+	var urls []string
+	for _, url := range []string{old.PosterURL, old.ThumbnailURL} {
+		if url != current.PosterURL && url != current.ThumbnailURL {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// writeMovie runs write in a transaction together with the revision recording
+// the change from before to after, so no change is saved without its audit
+// trail entry. Caches derived from movies are invalidated once it commits.
+func (app *application) writeMovie(r *http.Request, action string, before, after *data.Movie, write func(tx data.Models) error) error {
+	var userID int64
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		userID = user.ID
+	}
+	err := app.models.InTx(r.Context(), func(tx data.Models) error {
+		err := write(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Revisions.Insert(data.NewMovieRevision(action, userID, before, after))
+	})
+	if err != nil {
+		return err
+	}
+	app.moviesChanged()
+	return nil
+}
+
+func (app *application) listMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-version")
+	input.Filters.SortSafeList = []string{"version", "created_at", "-version", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAllForMovie(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Movies created before revisions were recorded have no history yet, so
+	// an empty list only means not found when the movie does not exist.
+	if metadata.TotalRecords == 0 {
+		exists, err := app.models.Movies.Exists(id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !exists {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) revertMovieHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	version := app.readInt(r.URL.Query(), "version", 0, v)
+	v.Check(version > 0, "version", "must be a positive integer")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	rev, err := app.models.Revisions.GetVersion(id, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("version", "no revision exists for this version")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *movie
+	movie.Title = rev.Snapshot.Title
+	movie.Year = rev.Snapshot.Year
+	movie.Runtime = rev.Snapshot.Runtime
+	movie.Genres = rev.Snapshot.Genres
+	movie.Synopsis = rev.Snapshot.Synopsis
+	movie.PosterURL = rev.Snapshot.PosterURL
+	movie.ThumbnailURL = rev.Snapshot.ThumbnailURL
+
+	if data.ValidateMovie(v, movie, app.config.movieRules); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.writeMovie(r, data.RevisionRevert, &before, movie, func(tx data.Models) error {
+		return tx.Movies.Update(movie)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -15,10 +15,66 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthCheckHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticOrID(map[string]http.HandlerFunc{
+		"trash":   app.requirePermission("movies:write", app.listDeletedMovieHandler),
+		"export":  app.requirePermission("movies:read", app.exportMovieHandler),
+		"suggest": app.requirePermission("movies:read", app.suggestMovieHandler),
+	}, app.requirePermission("movies:read", app.resolveMovieParam(app.showMovieHandler))))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.resolveMovieParam(app.updateMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.resolveMovieParam(app.deleteMovieHandler)))
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMovieHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id", app.staticOrID(map[string]http.HandlerFunc{
+		"batch": app.requirePermission("movies:write", app.batchMovieHandler),
+	}, app.methodNotAllowedResponse))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/similar", app.requirePermission("movies:read", app.resolveMovieParam(app.listSimilarMoviesHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/history", app.requirePermission("movies:read", app.resolveMovieParam(app.listMovieRevisionsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/revert", app.requirePermission("movies:write", app.resolveMovieParam(app.revertMovieHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/restore", app.requirePermission("movies:write", app.resolveMovieParam(app.restoreMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/tags", app.requirePermission("movies:read", app.resolveMovieParam(app.listMovieTagsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/tags", app.requirePermission("tags:write", app.resolveMovieParam(app.tagMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/tags/:tag", app.requirePermission("tags:write", app.resolveMovieParam(app.untagMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/translations", app.requirePermission("movies:read", app.resolveMovieParam(app.listMovieTranslationsHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/translations/:locale", app.requirePermission("movies:write", app.resolveMovieParam(app.putMovieTranslationHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/translations/:locale", app.requirePermission("movies:write", app.resolveMovieParam(app.deleteMovieTranslationHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/availability", app.requirePermission("movies:read", app.resolveMovieParam(app.listMovieAvailabilityHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/availability", app.requirePermission("movies:write", app.resolveMovieParam(app.createMovieAvailabilityHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/availability/:availability_id", app.requirePermission("movies:write", app.resolveMovieParam(app.updateMovieAvailabilityHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/availability/:availability_id", app.requirePermission("movies:write", app.resolveMovieParam(app.deleteMovieAvailabilityHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/movies/:id/poster", app.requirePermission("movies:write", app.resolveMovieParam(app.uploadMoviePosterHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.requirePermission("movies:read", app.listCollectionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requirePermission("movies:write", app.createCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.requirePermission("movies:read", app.showCollectionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id", app.requirePermission("movies:write", app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.requirePermission("movies:write", app.deleteCollectionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/tags", app.requirePermission("tags:moderate", app.listTagsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags/:id/approve", app.requirePermission("tags:moderate", app.approveTagHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags/:id/ban", app.requirePermission("tags:moderate", app.banTagHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags/:id/merge", app.requirePermission("tags:moderate", app.mergeTagHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.listListsHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requireActivatedUser(app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:slug", app.showListHandler)
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:slug", app.requireActivatedUser(app.updateListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:slug", app.requireActivatedUser(app.deleteListHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:slug/items", app.requireActivatedUser(app.addListItemHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:slug/items", app.requireActivatedUser(app.reorderListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:slug/items/:id", app.requireActivatedUser(app.resolveMovieParam(app.removeListItemHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:slug/follow", app.requireActivatedUser(app.followListHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:slug/follow", app.requireActivatedUser(app.unfollowListHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/movies/duplicates", app.requirePermission("movies:admin", app.listDuplicateMoviesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/movies/merge", app.requirePermission("movies:admin", app.mergeMoviesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.requirePermission("movies:read", app.showMovieStatsHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/imports", app.requirePermission("movies:write", app.createImportHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/imports/:id", app.requirePermission("movies:write", app.showImportHandler))
+
+	if app.config.storage.backend == "local" {
+		router.ServeFiles(app.config.storage.localURL+"/*filepath", http.Dir(app.config.storage.localDir))
+	}
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
@@ -27,3 +83,17 @@ func (app *application) routes() http.Handler {
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
 }
+
+// staticOrID lets fixed paths such as /v1/movies/trash share a position with
+// an :id wildcard, which httprouter does not allow. Requests whose :id matches
+// a key in static go to that handler and everything else goes to next.
+func (app *application) staticOrID(static map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"lightsaber.dkadev.xyz/internal/jsonlog"
+)
+
+func TestStaticOrID(t *testing.T) {
+	app := &application{logger: jsonlog.New(nil, jsonlog.LevelOff)}
+
+	handler := func(name string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}
+	}
+
+	router := httprouter.New()
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.staticOrID(map[string]http.HandlerFunc{
+		"trash": handler("trash"),
+	}, handler("show")))
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/v1/movies/trash", "trash"},
+		{"/v1/movies/1", "show"},
+		{"/v1/movies/trashcan", "show"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if w.Body.String() != tt.want {
+				t.Errorf("expected %q handler, got %q", tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -34,6 +34,7 @@ func (app *application) serve() error {
 		if err != nil {
 			shutdownError <- err
 		}
+		close(app.shutdown)
 		app.logger.PrintInfo("completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"lightsaber.dkadev.xyz/internal/data"
+)
+
+// resolveMovieParam lets the :id parameter of movie routes be either an id or
+// a slug. A current slug is swapped for the movie's id before next runs, so
+// handlers keep using readIdParam. Ids of merged movies and old slugs are
+// answered with a permanent redirect to the same path for the movie they now
+// belong to.
+func (app *application) resolveMovieParam(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		param := params.ByName("id")
+
+		if id, err := strconv.ParseInt(param, 10, 64); err == nil {
+			movieID, err := app.models.Movies.GetRedirect(id)
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				next(w, r)
+			case err != nil:
+				app.serverErrorResponse(w, r, err)
+			default:
+				app.redirectMovie(w, r, param, strconv.FormatInt(movieID, 10))
+			}
+			return
+		}
+
+		id, err := app.models.Movies.GetIDBySlug(param)
+		switch {
+		case err == nil:
+			resolved := make(httprouter.Params, len(params))
+			copy(resolved, params)
+			for i := range resolved {
+				if resolved[i].Key == "id" {
+					resolved[i].Value = strconv.FormatInt(id, 10)
+				}
+			}
+			next(w, r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, resolved)))
+			return
+		case !errors.Is(err, data.ErrRecordNotFound):
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		current, err := app.models.Movies.GetSlugRedirect(param)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		app.redirectMovie(w, r, param, current)
+	}
+}
+
+// redirectMovie redirects to the request path with the movie segment from
+// replaced by to. The movie segment follows "movies" in movie routes and
+// "items" in list routes. Requests other than GET and HEAD get 308 instead of
+// 301 so that clients repeat them with the same method and body.
+func (app *application) redirectMovie(w http.ResponseWriter, r *http.Request, from, to string) {
+	status := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	segments := strings.Split(r.URL.Path, "/")
+	for i := 1; i < len(segments); i++ {
+		if segments[i] == from && (segments[i-1] == "movies" || segments[i-1] == "items") {
+			segments[i] = to
+			break
+		}
+	}
+	target := url.URL{
+		Path:     strings.Join(segments, "/"),
+		RawQuery: r.URL.RawQuery,
+	}
+	http.Redirect(w, r, target.String(), status)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectMovie(t *testing.T) {
+	app := &application{}
+	tests := []struct {
+		method, target string
+		wantStatus     int
+		wantLocation   string
+	}{
+		{http.MethodGet, "/v1/movies/the-matrix-1998", http.StatusMovedPermanently, "/v1/movies/the-matrix-1999"},
+		{http.MethodGet, "/v1/movies/the-matrix-1998/tags?limit=5", http.StatusMovedPermanently, "/v1/movies/the-matrix-1999/tags?limit=5"},
+		{http.MethodPatch, "/v1/movies/the-matrix-1998", http.StatusPermanentRedirect, "/v1/movies/the-matrix-1999"},
+		{http.MethodDelete, "/v1/lists/the-matrix-1998/items/the-matrix-1998", http.StatusPermanentRedirect, "/v1/lists/the-matrix-1998/items/the-matrix-1999"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		app.redirectMovie(w, httptest.NewRequest(tt.method, tt.target, nil), "the-matrix-1998", "the-matrix-1999")
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.target, w.Code, tt.wantStatus)
+		}
+		if got := w.Header().Get("Location"); got != tt.wantLocation {
+			t.Errorf("%s %s: got Location %q, want %q", tt.method, tt.target, got, tt.wantLocation)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+type cachedStats struct {
+	generation int64
+	stats      *data.MovieStats
+}
+
+func (app *application) showMovieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	recent := app.readInt(r.URL.Query(), "recent", 10, v)
+
+	v.Check(recent >= 0, "recent", "must not be negative")
+	v.Check(recent <= 50, "recent", "must be a maximum of 50")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Like suggestions, results are tagged with the generation of movies they
+	// were read from.
+	generation := app.moviesGeneration.Load()
+	cached, ok := app.stats.Get(recent)
+	stats := cached.stats
+	if !ok || cached.generation != generation {
+		var err error
+		stats, err = app.models.Movies.Stats(recent)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.stats.Set(recent, cachedStats{generation, stats})
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"lightsaber.dkadev.xyz/internal/cache"
+	"lightsaber.dkadev.xyz/internal/data"
+)
+
+func TestShowMovieStatsHandler(t *testing.T) {
+	app := &application{stats: cache.NewTTL[int, cachedStats](time.Minute)}
+	app.stats.Set(10, cachedStats{0, &data.MovieStats{Total: 42}})
+
+	// A cached result is served without touching the database.
+	w := httptest.NewRecorder()
+	app.showMovieStatsHandler(w, httptest.NewRequest(http.MethodGet, "/v1/stats/movies", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusOK)
+	}
+	var body struct {
+		Stats data.MovieStats `json:"stats"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Stats.Total != 42 {
+		t.Errorf("got total %d, want 42", body.Stats.Total)
+	}
+
+	for _, target := range []string{"/v1/stats/movies?recent=-1", "/v1/stats/movies?recent=51", "/v1/stats/movies?recent=x"} {
+		w := httptest.NewRecorder()
+		app.showMovieStatsHandler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: got status %d, want %d", target, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+type cachedSuggestions struct {
+	generation  int64
+	suggestions []*data.MovieSuggestion
+}
+
+func (app *application) suggestMovieHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	q := strings.TrimSpace(qs.Get("q"))
+	limit := app.readInt(qs, "limit", 10, v)
+
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 20, "limit", "must be a maximum of 20")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	key := strconv.Itoa(limit) + ":" + strings.ToLower(q)
+	// Entries are tagged with the generation read before the query, so that
+	// results cached after a concurrent write purged the cache are ignored.
+	generation := app.moviesGeneration.Load()
+	cached, ok := app.suggestions.Get(key)
+	suggestions := cached.suggestions
+	if !ok || cached.generation != generation {
+		var err error
+		suggestions, err = app.models.Movies.Suggest(q, limit)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.suggestions.Set(key, cachedSuggestions{generation, suggestions})
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// moviesChanged drops everything cached from the movies table and starts a
+// new generation of it. It is called after every write to movies.
+func (app *application) moviesChanged() {
+	app.moviesGeneration.Add(1)
+	if app.suggestions != nil {
+		app.suggestions.Purge()
+	}
+	if app.stats != nil {
+		app.stats.Purge()
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"lightsaber.dkadev.xyz/internal/data"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+func (app *application) listMovieTagsHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+	app.writeMovieTags(w, r, movie)
+}
+
+func (app *application) tagMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Tags []string `json:"tags"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	for i, tag := range input.Tags {
+		input.Tags[i] = data.NormalizeTag(tag)
+	}
+	v := validator.New()
+	if data.ValidateTags(v, input.Tags); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	userID := app.contextGetUser(r).ID
+	err = app.models.InTx(r.Context(), func(tx data.Models) error {
+		return tx.Tags.Apply(movie.ID, userID, input.Tags)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrBannedTag):
+			app.failedValidationResponse(w, r, map[string]string{"tags": "must not contain banned tags"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeMovieTags(w, r, movie)
+}
+
+func (app *application) untagMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+	tag := data.NormalizeTag(httprouter.ParamsFromContext(r.Context()).ByName("tag"))
+	err := app.models.Tags.Remove(movie.ID, app.contextGetUser(r).ID, tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeMovieTags(w, r, movie)
+}
+
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string
+		data.Filters
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Status = app.readString(qs, "status", data.TagPending)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafeList = []string{"id", "name", "created_at", "-id", "-name", "-created_at"}
+
+	if input.Status != "all" {
+		v.Check(validator.In(input.Status, data.TagStatuses...), "status", "must be one of pending, approved, banned, merged or all")
+	} else {
+		input.Status = ""
+	}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tags, metadata, err := app.models.Tags.GetAll(input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"tags": tags, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) approveTagHandler(w http.ResponseWriter, r *http.Request) {
+	app.moderateTag(w, r, data.TagApproved)
+}
+
+func (app *application) banTagHandler(w http.ResponseWriter, r *http.Request) {
+	app.moderateTag(w, r, data.TagBanned)
+}
+
+func (app *application) moderateTag(w http.ResponseWriter, r *http.Request, status string) {
+	tag, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+	if tag.Status == data.TagMerged {
+		app.failedValidationResponse(w, r, map[string]string{"status": "can not be changed for a merged tag"})
+		return
+	}
+	err := app.models.InTx(r.Context(), func(tx data.Models) error {
+		return tx.Tags.SetStatus(tag, status)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) mergeTagHandler(w http.ResponseWriter, r *http.Request) {
+	source, ok := app.readTag(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Into int64 `json:"into"`
+	}
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	target, err := app.models.Tags.Get(input.Into)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.failedValidationResponse(w, r, map[string]string{"into": "must be an existing tag"})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.InTx(r.Context(), func(tx data.Models) error {
+		return tx.Tags.Merge(source, target)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidTag):
+			app.failedValidationResponse(w, r, map[string]string{"into": "must be a different tag that is neither banned nor merged, and the tag must not already be merged"})
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"tag": source}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieParam loads the movie named by the :id parameter, sending a not
+// found response and returning false if there is none.
+func (app *application) readMovieParam(w http.ResponseWriter, r *http.Request) (*data.Movie, bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return movie, true
+}
+
+func (app *application) readTag(w http.ResponseWriter, r *http.Request) (*data.Tag, bool) {
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	tag, err := app.models.Tags.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return tag, true
+}
+
+func (app *application) writeMovieTags(w http.ResponseWriter, r *http.Request, movie *data.Movie) {
+	counts, err := app.models.Tags.CountsForMovies([]int64{movie.ID})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	tags := counts[movie.ID]
+	if tags == nil {
+		tags = []data.TagCount{}
+	}
+	err = app.writeJson(w, http.StatusOK, envelope{"tags": tags}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,39 @@
+package cache
+
+import "testing"
+
+func TestLRU(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("expected a=1, got %d %v", v, ok)
+	}
+
+	// b is now the least recently used entry and is evicted.
+	c.Set("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("expected a to be kept")
+	}
+
+	c.Set("a", 10)
+	if v, _ := c.Get("a"); v != 10 || c.Len() != 2 {
+		t.Errorf("expected a to be updated in place, got %d with %d entries", v, c.Len())
+	}
+
+	c.Purge()
+	if _, ok := c.Get("a"); ok || c.Len() != 0 {
+		t.Error("expected the cache to be empty after Purge")
+	}
+}
+
+func TestLRUDisabled(t *testing.T) {
+	c := NewLRU[string, int](0)
+	c.Set("a", 1)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected a zero capacity cache to store nothing")
+	}
+}
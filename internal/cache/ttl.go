@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// TTL is a cache whose entries expire a fixed time after they are set. Expired
+// entries are dropped when they are next looked up, so it is only meant for a
+// small, bounded set of keys. It is safe for concurrent use.
+type TTL[K comparable, V any] struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	items map[K]ttlEntry[V]
+	now   func() time.Time
+}
+
+type ttlEntry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// NewTTL returns a cache keeping entries for ttl. A ttl of 0 or less disables
+// caching.
+func NewTTL[K comparable, V any](ttl time.Duration) *TTL[K, V] {
+	return &TTL[K, V]{
+		ttl:   ttl,
+		items: make(map[K]ttlEntry[V]),
+		now:   time.Now,
+	}
+}
+
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		if c.now().Before(e.expires) {
+			return e.value, true
+		}
+		delete(c.items, key)
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *TTL[K, V]) Set(key K, value V) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = ttlEntry[V]{value: value, expires: c.now().Add(c.ttl)}
+}
+
+// Purge removes every entry.
+func (c *TTL[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.items)
+}
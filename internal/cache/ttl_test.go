@@ -0,0 +1,39 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := NewTTL[int, string](time.Minute)
+	c.now = func() time.Time { return now }
+
+	c.Set(1, "a")
+	now = now.Add(59 * time.Second)
+	if v, ok := c.Get(1); !ok || v != "a" {
+		t.Fatalf("expected 1=a before expiry, got %q %v", v, ok)
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.Get(1); ok {
+		t.Error("expected 1 to expire after the ttl")
+	}
+	if len(c.items) != 0 {
+		t.Error("expected the expired entry to be dropped")
+	}
+
+	c.Set(2, "b")
+	c.Purge()
+	if _, ok := c.Get(2); ok {
+		t.Error("expected the cache to be empty after Purge")
+	}
+}
+
+func TestTTLDisabled(t *testing.T) {
+	c := NewTTL[int, string](0)
+	c.Set(1, "a")
+	if _, ok := c.Get(1); ok {
+		t.Error("expected a zero ttl cache to store nothing")
+	}
+}
@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+const (
+	AvailabilityStream = "stream"
+	AvailabilityRent   = "rent"
+	AvailabilityBuy    = "buy"
+)
+
+var AvailabilityTypes = []string{AvailabilityStream, AvailabilityRent, AvailabilityBuy}
+
+var (
+	ErrDuplicateAvailability = errors.New("duplicate availability")
+	ErrInvalidDateFormat     = errors.New("invalid date format")
+)
+
+var (
+	RegionRX   = regexp.MustCompile(`^[A-Z]{2}$`)
+	ProviderRX = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+const dateLayout = "2006-01-02"
+
+// Date is a calendar day, written as "2006-01-02" in JSON.
+type Date struct {
+	time.Time
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.Format(dateLayout))), nil
+}
+
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	unquoted, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+	t, err := time.Parse(dateLayout, unquoted)
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+	d.Time = t
+	return nil
+}
+
+// Availability is a window during which a movie can be streamed, rented or
+// bought from a provider in a region. Both ends of the window are inclusive
+// and an open end means the movie stays available.
+type Availability struct {
+	ID       int64  `json:"id"`
+	MovieID  int64  `json:"movie_id"`
+	Region   string `json:"region"`
+	Provider string `json:"provider"`
+	Type     string `json:"type"`
+	StartsOn Date   `json:"starts_on"`
+	EndsOn   *Date  `json:"ends_on"`
+	// Active reports whether the window includes the current date.
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	Version   int32     `json:"version"`
+}
+
+// NormalizeRegion and NormalizeProvider bring user input into the form
+// stored in the database, so that "us" and "US" are the same region.
+func NormalizeRegion(region string) string {
+	return strings.ToUpper(strings.TrimSpace(region))
+}
+
+func NormalizeProvider(provider string) string {
+	return strings.ToLower(strings.TrimSpace(provider))
+}
+
+func ValidateAvailability(v *validator.Validator, a *Availability) {
+	v.Check(validator.Matches(a.Region, RegionRX), "region", "must be a two letter ISO 3166 country code")
+	v.Check(a.Provider != "", "provider", "must be provided")
+	v.Check(len(a.Provider) <= 50, "provider", "must not be more than 50 bytes long")
+	v.Check(a.Provider == "" || validator.Matches(a.Provider, ProviderRX), "provider", "must only contain lowercase letters, digits and hyphens")
+	v.Check(validator.In(a.Type, AvailabilityTypes...), "type", "must be one of stream, rent or buy")
+	v.Check(!a.StartsOn.IsZero(), "starts_on", "must be provided")
+	v.Check(a.EndsOn == nil || !a.EndsOn.Before(a.StartsOn.Time), "ends_on", "must not be before starts_on")
+}
+
+type AvailabilityModel struct {
+	DB DBTX
+}
+
+const availabilityColumns = `id, movie_id, region, provider, type, starts_on, ends_on,
+	starts_on <= CURRENT_DATE AND (ends_on IS NULL OR ends_on >= CURRENT_DATE), created_at, version`
+
+func scanAvailability(row interface{ Scan(...any) error }, a *Availability) error {
+	var endsOn sql.NullTime
+	err := row.Scan(&a.ID, &a.MovieID, &a.Region, &a.Provider, &a.Type, &a.StartsOn.Time, &endsOn, &a.Active, &a.CreatedAt, &a.Version)
+	if err != nil {
+		return err
+	}
+	a.EndsOn = nil
+	if endsOn.Valid {
+		a.EndsOn = &Date{endsOn.Time}
+	}
+	return nil
+}
+
+func (a *Availability) endsOnArg() any {
+	if a.EndsOn == nil {
+		return nil
+	}
+	return a.EndsOn.Time
+}
+
+func (m AvailabilityModel) Insert(a *Availability) error {
+	query := `
+		INSERT INTO movie_availability (movie_id, region, provider, type, starts_on, ends_on)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING ` + availabilityColumns
+	args := []any{a.MovieID, a.Region, a.Provider, a.Type, a.StartsOn.Time, a.endsOnArg()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := scanAvailability(m.DB.QueryRowContext(ctx, query, args...), a)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_availability_window_key"`:
+			return ErrDuplicateAvailability
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns an availability record of the given movie.
+func (m AvailabilityModel) Get(movieID, id int64) (*Availability, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT ` + availabilityColumns + ` FROM movie_availability WHERE id = $1 AND movie_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var a Availability
+	err := scanAvailability(m.DB.QueryRowContext(ctx, query, id, movieID), &a)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &a, nil
+}
+
+// GetAllForMovie returns the availability of a movie, optionally limited to
+// one region.
+func (m AvailabilityModel) GetAllForMovie(movieID int64, region string) ([]*Availability, error) {
+	query := `SELECT ` + availabilityColumns + ` FROM movie_availability
+		WHERE movie_id = $1 AND (region = $2 OR $2 = '')
+		ORDER BY region, provider, type, starts_on`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	availability := []*Availability{}
+	for rows.Next() {
+		var a Availability
+		err := scanAvailability(rows, &a)
+		if err != nil {
+			return nil, err
+		}
+		availability = append(availability, &a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return availability, nil
+}
+
+func (m AvailabilityModel) Update(a *Availability) error {
+	query := `
+		UPDATE movie_availability
+		SET region = $1, provider = $2, type = $3, starts_on = $4, ends_on = $5, version = version + 1
+		WHERE id = $6 AND version = $7
+		RETURNING ` + availabilityColumns
+	args := []any{a.Region, a.Provider, a.Type, a.StartsOn.Time, a.endsOnArg(), a.ID, a.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := scanAvailability(m.DB.QueryRowContext(ctx, query, args...), a)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_availability_window_key"`:
+			return ErrDuplicateAvailability
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m AvailabilityModel) Delete(movieID, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM movie_availability WHERE id = $1 AND movie_id = $2`, id, movieID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
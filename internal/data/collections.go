@@ -0,0 +1,225 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+var (
+	ErrMovieInOtherCollection = errors.New("movie already belongs to another collection")
+	ErrUnknownMovie           = errors.New("unknown movie")
+)
+
+// Collection groups movies of a series, such as a trilogy, in viewing order.
+type Collection struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	MovieIDs    []int64   `json:"movie_ids"`
+	Version     int32     `json:"version"`
+}
+
+// MovieCollection is the collection a movie belongs to, as embedded in movie
+// responses. Position starts at 1.
+type MovieCollection struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Position int    `json:"position"`
+}
+
+func ValidateCollection(v *validator.Validator, c *Collection) {
+	v.Check(c.Name != "", "name", "must be provided")
+	v.Check(len(c.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(c.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+	v.Check(c.MovieIDs != nil, "movie_ids", "must be provided")
+	v.Check(len(c.MovieIDs) <= 1000, "movie_ids", "must not contain more than 1000 movies")
+	v.Check(validator.Unique(c.MovieIDs), "movie_ids", "must not contain duplicate values")
+}
+
+type CollectionModel struct {
+	DB DBTX
+}
+
+// Insert creates the collection and its membership. Run it in a transaction
+// so a rejected membership does not leave an empty collection behind.
+func (m CollectionModel) Insert(c *Collection) error {
+	query := `
+		INSERT INTO collections (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, c.Name, c.Description).Scan(&c.ID, &c.CreatedAt, &c.Version)
+	if err != nil {
+		return err
+	}
+	return m.setMovies(ctx, c)
+}
+
+func (m CollectionModel) Get(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, created_at, name, description, version,
+			ARRAY(SELECT movie_id FROM collection_movies WHERE collection_id = collections.id ORDER BY position)
+		FROM collections
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c Collection
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&c.ID, &c.CreatedAt, &c.Name, &c.Description, &c.Version, pq.Array(&c.MovieIDs))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+func (m CollectionModel) GetAll(name string, filters Filters) ([]*Collection, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, description, version,
+			ARRAY(SELECT movie_id FROM collection_movies WHERE collection_id = collections.id ORDER BY position)
+		FROM collections
+		WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
+		ORDER BY %s LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, likeEscaper.Replace(name), filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	collections := []*Collection{}
+	totalRecords := 0
+	for rows.Next() {
+		var c Collection
+		err := rows.Scan(&totalRecords, &c.ID, &c.CreatedAt, &c.Name, &c.Description, &c.Version, pq.Array(&c.MovieIDs))
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		collections = append(collections, &c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return collections, metadata, nil
+}
+
+// Update saves the collection and replaces its membership with MovieIDs, in
+// that order. Run it in a transaction.
+func (m CollectionModel) Update(c *Collection) error {
+	query := `
+		UPDATE collections
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, c.Name, c.Description, c.ID, c.Version).Scan(&c.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM collection_movies WHERE collection_id = $1`, c.ID)
+	if err != nil {
+		return err
+	}
+	return m.setMovies(ctx, c)
+}
+
+func (m CollectionModel) setMovies(ctx context.Context, c *Collection) error {
+	query := `
+		INSERT INTO collection_movies (collection_id, movie_id, position)
+		SELECT $1, movie_id, position
+		FROM unnest($2::bigint[]) WITH ORDINALITY AS t (movie_id, position)`
+	_, err := m.DB.ExecContext(ctx, query, c.ID, pq.Array(c.MovieIDs))
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collection_movies_pkey"`:
+			return ErrMovieInOtherCollection
+		case err.Error() == `pq: insert or update on table "collection_movies" violates foreign key constraint "collection_movies_movie_id_fkey"`:
+			return ErrUnknownMovie
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM collections WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetForMovies returns the collection of each of the given movies that
+// belongs to one, keyed by movie id.
+func (m CollectionModel) GetForMovies(movieIDs []int64) (map[int64]*MovieCollection, error) {
+	query := `
+		SELECT cm.movie_id, c.id, c.name, cm.position
+		FROM collection_movies cm
+		JOIN collections c ON c.id = cm.collection_id
+		WHERE cm.movie_id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	collections := make(map[int64]*MovieCollection)
+	for rows.Next() {
+		var movieID int64
+		var mc MovieCollection
+		err := rows.Scan(&movieID, &mc.ID, &mc.Name, &mc.Position)
+		if err != nil {
+			return nil, err
+		}
+		collections[movieID] = &mc
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
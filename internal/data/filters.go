@@ -1,6 +1,11 @@
 package data
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"strings"
 
@@ -14,6 +19,90 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	// UseCursor switches from page numbers to keyset pagination. Cursor is
+	// then the opaque next_cursor or prev_cursor of a previous response, or
+	// empty for the first page.
+	UseCursor bool
+	Cursor    string
+	// SkipCount leaves out the total record count, which is the expensive
+	// part of a cursor page.
+	SkipCount bool
+	// Fields limits the columns read for each record. Empty reads them all.
+	Fields []string
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	cursorNext = "next"
+	cursorPrev = "prev"
+)
+
+// cursor marks the position of a page boundary: the values of every sort key,
+// including the id tie-breaker, of the last row of a page (for next) or the
+// first row (for prev).
+type cursor struct {
+	Sort      string `json:"s"`
+	Values    []any  `json:"v"`
+	Direction string `json:"d"`
+}
+
+func encodeCursor(c cursor) string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// integerSortColumns are the sort columns whose cursor values are integers.
+// The values of every other column are strings.
+var integerSortColumns = []string{"id", "year", "runtime", "version"}
+
+// decodeCursor decodes a cursor for the given sort keys. Every value must
+// have the type of its column, so a tampered cursor is rejected here instead
+// of failing in the database.
+func decodeCursor(s string, keys []sortKey) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+	err = dec.Decode(&c)
+	if err != nil || len(c.Values) != len(keys) || (c.Direction != cursorNext && c.Direction != cursorPrev) {
+		return nil, ErrInvalidCursor
+	}
+	for i, k := range keys {
+		switch value := c.Values[i].(type) {
+		case json.Number:
+			n, err := value.Int64()
+			if err != nil || !slices.Contains(integerSortColumns, k.column) {
+				return nil, ErrInvalidCursor
+			}
+			c.Values[i] = n
+		case string:
+			if slices.Contains(integerSortColumns, k.column) {
+				return nil, ErrInvalidCursor
+			}
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+	return &c, nil
+}
+
+// cursor returns the decoded cursor, or nil for the first page.
+func (f Filters) cursor() (*cursor, error) {
+	if f.Cursor == "" {
+		return nil, nil
+	}
+	c, err := decodeCursor(f.Cursor, f.sortKeys())
+	if err != nil {
+		return nil, err
+	}
+	if c.Sort != f.Sort {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
 }
 
 func (f Filters) limit() int {
@@ -29,30 +118,105 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 10_000_000, "page", "must be a max of 10 mil")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
-	v.Check(validator.In(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+	keys := strings.Split(f.Sort, ",")
+	columns := make([]string, 0, len(keys))
+	for _, key := range keys {
+		v.Check(validator.In(key, f.SortSafeList...), "sort", "invalid sort value")
+		columns = append(columns, strings.TrimPrefix(key, "-"))
+	}
+	v.Check(validator.Unique(columns), "sort", "must not sort by the same field twice")
+	v.Check(len(keys) <= maxSortKeys, "sort", "must not contain more than 3 fields")
+	if f.UseCursor && v.Valid() {
+		_, err := f.cursor()
+		v.Check(err == nil, "cursor", "must be a cursor returned by a previous request with the same sort")
+	}
 }
 
-func (f Filters) sortColumn() string {
-	if slices.Contains(f.SortSafeList, f.Sort) {
-		return strings.TrimPrefix(f.Sort, "-")
-	}
+const maxSortKeys = 3
 
-	panic("unsafe sort parameter: " + f.Sort)
+type sortKey struct {
+	column string
+	desc   bool
 }
 
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
+func (k sortKey) direction() string {
+	if k.desc {
 		return "DESC"
 	}
 	return "ASC"
 }
 
+// sortKeys parses a comma-separated sort such as "-year,title" and appends id
+// as a final tie-breaker unless it is already one of the keys, so the order
+// is always total.
+func (f Filters) sortKeys() []sortKey {
+	var keys []sortKey
+	hasID := false
+	for _, key := range strings.Split(f.Sort, ",") {
+		if !slices.Contains(f.SortSafeList, key) {
+			panic("unsafe sort parameter: " + key)
+		}
+		k := sortKey{column: strings.TrimPrefix(key, "-"), desc: strings.HasPrefix(key, "-")}
+		if key == "relevance" {
+			// The best search matches come first; rank is selected by
+			// MovieFilter.searchColumns.
+			k = sortKey{column: "rank", desc: true}
+		}
+		hasID = hasID || k.column == "id"
+		keys = append(keys, k)
+	}
+	if !hasID {
+		keys = append(keys, sortKey{column: "id"})
+	}
+	return keys
+}
+
+// orderBy returns the ORDER BY expression for the sort keys.
+func (f Filters) orderBy() string {
+	return orderBy(f.sortKeys())
+}
+
+func orderBy(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k.column + " " + k.direction()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// keysetCondition returns the condition selecting the rows that come after
+// values in the given order, e.g. for "year DESC, id ASC"
+// (year < $1 OR (year = $1 AND id > $2)). The values are appended to args.
+func keysetCondition(keys []sortKey, values []any, args []any) (string, []any) {
+	placeholders := make([]string, len(keys))
+	for i := range keys {
+		args = append(args, values[i])
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	alternatives := make([]string, len(keys))
+	for i, k := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].column+" = "+placeholders[j])
+		}
+		op := ">"
+		if k.desc {
+			op = "<"
+		}
+		parts = append(parts, k.column+" "+op+" "+placeholders[i])
+		alternatives[i] = "(" + strings.Join(parts, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -0,0 +1,189 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// MaxImportErrors caps the row errors kept for an import so a completely
+// broken file does not produce an unbounded report.
+const MaxImportErrors = 1000
+
+type ImportRowError struct {
+	Line   int               `json:"line"`
+	Errors map[string]string `json:"errors"`
+}
+
+type Import struct {
+	ID            int64             `json:"id"`
+	UserID        *int64            `json:"user_id"`
+	Status        string            `json:"status"`
+	Format        string            `json:"format"`
+	DryRun        bool              `json:"dry_run"`
+	Mapping       map[string]string `json:"mapping,omitempty"`
+	Source        []byte            `json:"-"`
+	TotalRows     int               `json:"total_rows"`
+	ProcessedRows int               `json:"processed_rows"`
+	Created       int               `json:"created"`
+	Updated       int               `json:"updated"`
+	Failed        int               `json:"failed"`
+	Errors        []ImportRowError  `json:"errors"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Version       int32             `json:"version"`
+}
+
+// AddError counts a failed row and keeps its errors for the report.
+func (imp *Import) AddError(line int, errs map[string]string) {
+	imp.Failed++
+	if len(imp.Errors) < MaxImportErrors {
+		imp.Errors = append(imp.Errors, ImportRowError{Line: line, Errors: errs})
+	}
+}
+
+type ImportModel struct {
+	DB DBTX
+}
+
+func (m ImportModel) Insert(imp *Import) error {
+	mapping, err := json.Marshal(imp.Mapping)
+	if err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO imports (user_id, status, format, dry_run, mapping, source)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at, version`
+	args := []any{imp.UserID, imp.Status, imp.Format, imp.DryRun, mapping, imp.Source}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if imp.Errors == nil {
+		imp.Errors = []ImportRowError{}
+	}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&imp.ID, &imp.CreatedAt, &imp.UpdatedAt, &imp.Version)
+}
+
+// Get returns an import without its source file.
+func (m ImportModel) Get(id int64) (*Import, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `SELECT ` + importColumns + ` FROM imports WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var imp Import
+	err := scanImport(m.DB.QueryRowContext(ctx, query, id), &imp)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &imp, nil
+}
+
+// GetUnfinished returns the imports that are still pending or were running
+// when the server stopped, including their source files, oldest first.
+func (m ImportModel) GetUnfinished() ([]*Import, error) {
+	query := `SELECT ` + importColumns + `, source FROM imports
+		WHERE status IN ('pending', 'running')
+		ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	imports := []*Import{}
+	for rows.Next() {
+		var imp Import
+		err := scanImport(rows, &imp, &imp.Source)
+		if err != nil {
+			return nil, err
+		}
+		imports = append(imports, &imp)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return imports, nil
+}
+
+// UpdateProgress saves the status and counters of an import.
+func (m ImportModel) UpdateProgress(imp *Import) error {
+	errs, err := json.Marshal(imp.Errors)
+	if err != nil {
+		return err
+	}
+	query := `
+		UPDATE imports
+		SET status = $1, total_rows = $2, processed_rows = $3, created = $4, updated = $5, failed = $6,
+			errors = $7, updated_at = NOW(), version = version + 1
+		WHERE id = $8 AND version = $9
+		RETURNING updated_at, version`
+	args := []any{imp.Status, imp.TotalRows, imp.ProcessedRows, imp.Created, imp.Updated, imp.Failed, errs, imp.ID, imp.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&imp.UpdatedAt, &imp.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+const importColumns = `id, user_id, status, format, dry_run, mapping, total_rows, processed_rows,
+	created, updated, failed, errors, created_at, updated_at, version`
+
+func scanImport(row interface{ Scan(...any) error }, imp *Import, extra ...any) error {
+	var mapping, errs []byte
+	dest := []any{
+		&imp.ID,
+		&imp.UserID,
+		&imp.Status,
+		&imp.Format,
+		&imp.DryRun,
+		&mapping,
+		&imp.TotalRows,
+		&imp.ProcessedRows,
+		&imp.Created,
+		&imp.Updated,
+		&imp.Failed,
+		&errs,
+		&imp.CreatedAt,
+		&imp.UpdatedAt,
+		&imp.Version,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(mapping, &imp.Mapping)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(errs, &imp.Errors)
+}
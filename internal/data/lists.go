@@ -0,0 +1,383 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+const (
+	ListPrivate  = "private"
+	ListUnlisted = "unlisted"
+	ListPublic   = "public"
+)
+
+var ListVisibilities = []string{ListPrivate, ListUnlisted, ListPublic}
+
+var ErrDuplicateListItem = errors.New("movie already on list")
+
+// List is a user's ordered selection of movies. Private lists are only
+// visible to their owner, unlisted lists to anyone who has the slug, and
+// public lists are also included in list browsing.
+type List struct {
+	ID            int64       `json:"id"`
+	UserID        int64       `json:"user_id"`
+	Slug          string      `json:"slug"`
+	Title         string      `json:"title"`
+	Description   string      `json:"description,omitempty"`
+	Visibility    string      `json:"visibility"`
+	ItemCount     int         `json:"item_count"`
+	FollowerCount int         `json:"follower_count"`
+	Items         []*ListItem `json:"items,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	Version       int32       `json:"version"`
+}
+
+// ListItem is a movie on a list. Position starts at 1 and has no gaps.
+type ListItem struct {
+	Position int       `json:"position"`
+	MovieID  int64     `json:"movie_id"`
+	Title    string    `json:"title"`
+	Year     int32     `json:"year,omitempty"`
+	Note     string    `json:"note,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Title != "", "title", "must be provided")
+	v.Check(len(list.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(list.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+	v.Check(validator.In(list.Visibility, ListVisibilities...), "visibility", "must be one of private, unlisted or public")
+}
+
+func ValidateListItemNote(v *validator.Validator, note string) {
+	v.Check(len(note) <= 1000, "note", "must not be more than 1000 bytes long")
+}
+
+// generateSlug returns a random slug for share links. It carries as much
+// entropy as an authentication token so that unlisted lists can not be
+// guessed.
+func generateSlug() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)), nil
+}
+
+// ListFilter selects the lists returned by GetAll. Whatever the filter, only
+// lists that ViewerID is allowed to see are returned; ViewerID is 0 for
+// anonymous users.
+type ListFilter struct {
+	ViewerID   int64
+	OwnerID    int64
+	FollowedBy int64
+}
+
+func (f ListFilter) where(args []any) (string, []any) {
+	var clauses []string
+	add := func(format string, value any) {
+		args = append(args, value)
+		clauses = append(clauses, fmt.Sprintf(format, len(args)))
+	}
+
+	if f.FollowedBy > 0 {
+		// Following a list is done through its slug, so followers keep
+		// seeing unlisted lists.
+		add("id IN (SELECT list_id FROM list_follows WHERE user_id = $%d)", f.FollowedBy)
+		add("(visibility <> 'private' OR user_id = $%d)", f.ViewerID)
+	} else {
+		add("(visibility = 'public' OR user_id = $%d)", f.ViewerID)
+	}
+	if f.OwnerID > 0 {
+		add("user_id = $%d", f.OwnerID)
+	}
+	return "WHERE " + strings.Join(clauses, " AND "), args
+}
+
+type ListModel struct {
+	DB DBTX
+}
+
+const listColumns = `id, user_id, slug, title, description, visibility, created_at, updated_at, version,
+	(SELECT count(*) FROM list_items WHERE list_id = lists.id),
+	(SELECT count(*) FROM list_follows WHERE list_id = lists.id)`
+
+func listDest(list *List) []any {
+	return []any{
+		&list.ID,
+		&list.UserID,
+		&list.Slug,
+		&list.Title,
+		&list.Description,
+		&list.Visibility,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.Version,
+		&list.ItemCount,
+		&list.FollowerCount,
+	}
+}
+
+func (m ListModel) Insert(list *List) error {
+	slug, err := generateSlug()
+	if err != nil {
+		return err
+	}
+	list.Slug = slug
+	query := `
+		INSERT INTO lists (user_id, slug, title, description, visibility)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, version`
+	args := []any{list.UserID, list.Slug, list.Title, list.Description, list.Visibility}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt, &list.Version)
+}
+
+// GetBySlug returns the list with the given slug, or ErrRecordNotFound if it
+// does not exist or is private and viewerID is not its owner.
+func (m ListModel) GetBySlug(slug string, viewerID int64) (*List, error) {
+	query := `SELECT ` + listColumns + ` FROM lists
+		WHERE slug = $1 AND (visibility <> 'private' OR user_id = $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var list List
+	err := m.DB.QueryRowContext(ctx, query, slug, viewerID).Scan(listDest(&list)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &list, nil
+}
+
+func (m ListModel) GetAll(filter ListFilter, filters Filters) ([]*List, Metadata, error) {
+	where, args := filter.where(nil)
+	args = append(args, filters.limit(), filters.offset())
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM lists
+		%s
+		ORDER BY %s LIMIT $%d OFFSET $%d`, listColumns, where, filters.orderBy(), len(args)-1, len(args))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	lists := []*List{}
+	totalRecords := 0
+	for rows.Next() {
+		var list List
+		err := rows.Scan(append([]any{&totalRecords}, listDest(&list)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return lists, metadata, nil
+}
+
+// GetItems returns the items of a list in order. Movies in the trash are left
+// out.
+func (m ListModel) GetItems(listID int64) ([]*ListItem, error) {
+	query := `
+		SELECT row_number() OVER (ORDER BY li.position, li.added_at), li.movie_id, m.title, m.year, li.note, li.added_at
+		FROM list_items li
+		JOIN movies m ON m.id = li.movie_id
+		WHERE li.list_id = $1 AND m.deleted_at IS NULL
+		ORDER BY li.position, li.added_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*ListItem{}
+	for rows.Next() {
+		var item ListItem
+		err := rows.Scan(&item.Position, &item.MovieID, &item.Title, &item.Year, &item.Note, &item.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Update saves the list's details. When rotateSlug is true the list gets a
+// new slug, which invalidates links shared so far.
+func (m ListModel) Update(list *List, rotateSlug bool) error {
+	if rotateSlug {
+		slug, err := generateSlug()
+		if err != nil {
+			return err
+		}
+		list.Slug = slug
+	}
+	query := `
+		UPDATE lists
+		SET slug = $1, title = $2, description = $3, visibility = $4, updated_at = NOW(), version = version + 1
+		WHERE id = $5 AND version = $6
+		RETURNING updated_at, version`
+	args := []any{list.Slug, list.Title, list.Description, list.Visibility, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Touch records a change to the items of a list.
+func (m ListModel) Touch(list *List) error {
+	query := `
+		UPDATE lists
+		SET updated_at = NOW(), version = version + 1
+		WHERE id = $1
+		RETURNING updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, list.ID).Scan(&list.UpdatedAt, &list.Version)
+}
+
+func (m ListModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM lists WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// AddItem appends a movie to the end of a list.
+func (m ListModel) AddItem(listID, movieID int64, note string) error {
+	query := `
+		INSERT INTO list_items (list_id, movie_id, position, note)
+		SELECT $1, $2, COALESCE(MAX(position), 0) + 1, $3
+		FROM list_items
+		WHERE list_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, listID, movieID, note)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "list_items_pkey"`:
+			return ErrDuplicateListItem
+		case err.Error() == `pq: insert or update on table "list_items" violates foreign key constraint "list_items_movie_id_fkey"`:
+			return ErrUnknownMovie
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m ListModel) RemoveItem(listID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM list_items WHERE list_id = $1 AND movie_id = $2`, listID, movieID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Reorder puts the items of a list in the order of movieIDs. Items missing
+// from movieIDs, such as movies in the trash, keep their relative order after
+// the others.
+func (m ListModel) Reorder(listID int64, movieIDs []int64) error {
+	query := `
+		UPDATE list_items li
+		SET position = o.position
+		FROM (
+			SELECT movie_id, row_number() OVER (
+				ORDER BY COALESCE(array_position($2::bigint[], movie_id), 2147483647), position, added_at
+			) AS position
+			FROM list_items
+			WHERE list_id = $1
+		) o
+		WHERE li.list_id = $1 AND li.movie_id = o.movie_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, listID, pq.Array(movieIDs))
+	return err
+}
+
+// Follow subscribes a user to a list. Following a list twice is not an error.
+func (m ListModel) Follow(listID, userID int64) error {
+	query := `
+		INSERT INTO list_follows (list_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, listID, userID)
+	return err
+}
+
+func (m ListModel) Unfollow(listID, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM list_follows WHERE list_id = $1 AND user_id = $2`, listID, userID)
+	return err
+}
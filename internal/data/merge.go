@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DuplicateOptions tune how alike two movies must be to be reported as
+// duplicates.
+type DuplicateOptions struct {
+	// Threshold is the minimum title similarity, between 0 and 1, as computed
+	// by pg_trgm on the titles without a leading article.
+	Threshold float64
+	// YearTolerance and RuntimeTolerance are the largest differences in
+	// release year and in minutes of runtime that are still considered the
+	// same movie. An unknown runtime matches any other.
+	YearTolerance    int
+	RuntimeTolerance int
+}
+
+// DuplicateMovie is one side of a DuplicatePair.
+type DuplicateMovie struct {
+	ID      int64   `json:"id"`
+	Title   string  `json:"title"`
+	Year    int32   `json:"year"`
+	Runtime Runtime `json:"runtime,omitempty"`
+}
+
+// DuplicatePair is two movies that are probably the same film. The first has
+// the lower id.
+type DuplicatePair struct {
+	Movies [2]DuplicateMovie `json:"movies"`
+	Score  float64           `json:"score"`
+}
+
+// FindDuplicates returns up to limit pairs of movies outside the trash that
+// are probably duplicates, most similar first, and the number of pairs found
+// in total. Candidates come from the trigram index on movie_title_key, so
+// only titles above the threshold are ever compared.
+func (m MovieModel) FindDuplicates(opts DuplicateOptions, limit int) ([]DuplicatePair, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx := m.DB
+	if db, ok := m.DB.(*sql.DB); ok {
+		// The % operator reads its threshold from a setting, which must be
+		// set on the connection the query runs on.
+		t, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return nil, 0, err
+		}
+		defer t.Rollback()
+		tx = t
+	}
+	_, err := tx.ExecContext(ctx, `SELECT set_config('pg_trgm.similarity_threshold', $1, true)`,
+		strconv.FormatFloat(opts.Threshold, 'f', -1, 64))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT count(*) OVER(), a.id, a.title, a.year, a.runtime, b.id, b.title, b.year, b.runtime,
+			similarity(movie_title_key(a.title), movie_title_key(b.title)) AS score
+		FROM movies a
+		JOIN movies b ON movie_title_key(b.title) % movie_title_key(a.title) AND b.id > a.id
+		WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL
+			AND abs(a.year - b.year) <= $1
+			AND (a.runtime = 0 OR b.runtime = 0 OR abs(a.runtime - b.runtime) <= $2)
+		ORDER BY score DESC, a.id ASC, b.id ASC
+		LIMIT $3`
+	rows, err := tx.QueryContext(ctx, query, opts.YearTolerance, opts.RuntimeTolerance, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	total := 0
+	pairs := []DuplicatePair{}
+	for rows.Next() {
+		var p DuplicatePair
+		err := rows.Scan(&total,
+			&p.Movies[0].ID, &p.Movies[0].Title, &p.Movies[0].Year, &p.Movies[0].Runtime,
+			&p.Movies[1].ID, &p.Movies[1].Title, &p.Movies[1].Year, &p.Movies[1].Runtime,
+			&p.Score)
+		if err != nil {
+			return nil, 0, err
+		}
+		pairs = append(pairs, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return pairs, total, nil
+}
+
+// mergeStatements move everything that refers to the duplicate ($1) over to
+// the surviving movie ($2). Rows the survivor already has an equivalent of
+// are left behind and removed together with the duplicate.
+var mergeStatements = []string{
+	`INSERT INTO list_items (list_id, movie_id, position, note, added_at)
+		SELECT list_id, $2, position, note, added_at FROM list_items WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+	`UPDATE collection_movies SET movie_id = $2
+		WHERE movie_id = $1 AND NOT EXISTS (SELECT 1 FROM collection_movies WHERE movie_id = $2)`,
+	`INSERT INTO movie_tags (movie_id, tag_id, user_id, created_at)
+		SELECT $2, tag_id, user_id, created_at FROM movie_tags WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+	`INSERT INTO movie_translations (movie_id, locale, title, synopsis, created_at, updated_at)
+		SELECT $2, locale, title, synopsis, created_at, updated_at FROM movie_translations WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+	`INSERT INTO movie_availability (movie_id, region, provider, type, starts_on, ends_on, created_at)
+		SELECT $2, region, provider, type, starts_on, ends_on, created_at FROM movie_availability WHERE movie_id = $1
+		ON CONFLICT DO NOTHING`,
+	// Redirects to the duplicate now lead to the survivor, and so do its
+	// current and earlier slugs.
+	`UPDATE movie_redirects SET movie_id = $2 WHERE movie_id = $1`,
+	`UPDATE movie_slugs SET movie_id = $2 WHERE movie_id = $1`,
+	`INSERT INTO movie_slugs (slug, movie_id) SELECT slug, $2 FROM movies WHERE id = $1
+		ON CONFLICT (slug) DO UPDATE SET movie_id = EXCLUDED.movie_id`,
+}
+
+// GetForMerge reads the movies with the given ids that are not in the trash
+// and locks them until the transaction ends, so they can not change between
+// being merged and being deleted. The rows are locked in id order to avoid
+// deadlocks between overlapping merges. Run it in a transaction.
+func (m MovieModel) GetForMerge(ids []int64) (map[int64]*Movie, error) {
+	query := `SELECT ` + movieColumns + ` FROM movies
+			WHERE id = ANY($1) AND deleted_at IS NULL
+			ORDER BY id
+			FOR UPDATE`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	movies := make(map[int64]*Movie, len(ids))
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(movieDest(&movie)...)
+		if err != nil {
+			return nil, err
+		}
+		movies[movie.ID] = &movie
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// MergeInto folds the movie duplicateID into survivorID: list memberships,
+// collection membership, tags, translations and availability move to the
+// survivor, the duplicate is deleted, and its id and slugs redirect to the
+// survivor from then on. The survivor also takes over the duplicate's external id if
+// it has none, so that importing the same source again updates it instead of
+// recreating the duplicate. Run it in a transaction.
+func (m MovieModel) MergeInto(survivorID, duplicateID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, query := range mergeStatements {
+		_, err := m.DB.ExecContext(ctx, query, duplicateID, survivorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	var externalID sql.NullString
+	err := m.DB.QueryRowContext(ctx, `DELETE FROM movies WHERE id = $1 RETURNING external_id`, duplicateID).Scan(&externalID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	if externalID.Valid {
+		_, err = m.DB.ExecContext(ctx, `UPDATE movies SET external_id = $1 WHERE id = $2 AND external_id IS NULL`, externalID.String, survivorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = m.DB.ExecContext(ctx, `INSERT INTO movie_redirects (old_id, movie_id) VALUES ($1, $2)`, duplicateID, survivorID)
+	return err
+}
+
+// GetRedirect returns the id of the movie that the removed movie id was
+// merged into.
+func (m MovieModel) GetRedirect(id int64) (int64, error) {
+	if id < 1 {
+		return 0, ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var movieID int64
+	err := m.DB.QueryRowContext(ctx, `SELECT movie_id FROM movie_redirects WHERE old_id = $1`, id).Scan(&movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return movieID, nil
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 )
 
 var (
@@ -10,18 +12,107 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// DBTX is satisfied by both *sql.DB and *sql.Tx, so models that use it can
+// run inside a transaction.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies       MovieModel
+	Users        UserModel
+	Tokens       TokenModel
+	Permissions  PermissionModel
+	Revisions    RevisionModel
+	Imports      ImportModel
+	Similarities SimilarityModel
+	Collections  CollectionModel
+	Lists        ListModel
+	Tags         TagModel
+	Translations TranslationModel
+	Availability AvailabilityModel
+
+	db         *sql.DB
+	tx         *sql.Tx
+	savepoints *int
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		Movies:       MovieModel{DB: db},
+		Users:        UserModel{DB: db},
+		Tokens:       TokenModel{DB: db},
+		Permissions:  PermissionModel{DB: db},
+		Revisions:    RevisionModel{DB: db},
+		Imports:      ImportModel{DB: db},
+		Similarities: SimilarityModel{DB: db},
+		Collections:  CollectionModel{DB: db},
+		Lists:        ListModel{DB: db},
+		Tags:         TagModel{DB: db},
+		Translations: TranslationModel{DB: db},
+		Availability: AvailabilityModel{DB: db},
+		db:           db,
+	}
+}
+
+// InTx runs fn in a database transaction. The Models passed to fn issue their
+// queries on that transaction, which is committed if fn returns nil and rolled
+// back otherwise.
+func (m Models) InTx(ctx context.Context, fn func(tx Models) error) error {
+	if m.tx != nil {
+		return errors.New("data: nested transactions are not supported")
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txModels := m
+	txModels.Movies = MovieModel{DB: tx}
+	txModels.Revisions = RevisionModel{DB: tx}
+	txModels.Imports = ImportModel{DB: tx}
+	txModels.Similarities = SimilarityModel{DB: tx}
+	txModels.Collections = CollectionModel{DB: tx}
+	txModels.Lists = ListModel{DB: tx}
+	txModels.Tags = TagModel{DB: tx}
+	txModels.Translations = TranslationModel{DB: tx}
+	txModels.Availability = AvailabilityModel{DB: tx}
+	txModels.tx = tx
+	txModels.savepoints = new(int)
+
+	err = fn(txModels)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Savepoint runs fn inside a savepoint of the current transaction, so that a
+// failing statement only undoes the work done by fn instead of aborting the
+// whole transaction. It must be called on Models obtained from InTx.
+func (m Models) Savepoint(fn func() error) error {
+	if m.tx == nil {
+		return errors.New("data: savepoint used outside of a transaction")
+	}
+	*m.savepoints++
+	name := fmt.Sprintf("sp_%d", *m.savepoints)
+
+	ctx := context.Background()
+	_, err := m.tx.ExecContext(ctx, "SAVEPOINT "+name)
+	if err != nil {
+		return err
+	}
+	err = fn()
+	if err != nil {
+		_, rbErr := m.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		if rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
 	}
+	_, err = m.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
 }
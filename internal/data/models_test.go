@@ -1,7 +1,13 @@
 package data
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"lightsaber.dkadev.xyz/internal/validator"
 )
@@ -107,7 +113,7 @@ func TestValidateMovie(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			v := validator.New()
-			ValidateMovie(v, &tt.movie)
+			ValidateMovie(v, &tt.movie, DefaultMovieRules)
 
 			if tt.wantErr && v.Valid() {
 				t.Error("expected validation to fail")
@@ -201,3 +207,519 @@ func TestValidateUser(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffMovies(t *testing.T) {
+	before := &Movie{
+		ID:      1,
+		Title:   "Test Movie",
+		Year:    2023,
+		Runtime: 120,
+		Genres:  []string{"Action"},
+		Version: 1,
+	}
+
+	t.Run("create", func(t *testing.T) {
+		changes := DiffMovies(nil, before)
+		for _, field := range []string{"title", "year", "runtime", "genres"} {
+			if _, ok := changes[field]; !ok {
+				t.Errorf("expected %s to be recorded", field)
+			}
+		}
+		if changes["title"].From != nil {
+			t.Errorf("expected title to change from nil, got %v", changes["title"].From)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		after := *before
+		after.Title = "Renamed"
+		after.Runtime = 95
+		after.Version = 2
+
+		changes := DiffMovies(before, &after)
+		if len(changes) != 2 {
+			t.Fatalf("expected 2 changes, got %v", changes)
+		}
+		if changes["title"].From != "Test Movie" || changes["title"].To != "Renamed" {
+			t.Errorf("unexpected title change %v", changes["title"])
+		}
+		if changes["runtime"].From != "120 mins" || changes["runtime"].To != "95 mins" {
+			t.Errorf("unexpected runtime change %v", changes["runtime"])
+		}
+	})
+
+	t.Run("no changes", func(t *testing.T) {
+		after := *before
+		if changes := DiffMovies(before, &after); len(changes) != 0 {
+			t.Errorf("expected no changes, got %v", changes)
+		}
+	})
+}
+
+func TestCursor(t *testing.T) {
+	safe := []string{"id", "title", "year", "-id", "-title", "-year"}
+	encoded := encodeCursor(cursor{Sort: "-year,title", Values: []any{int32(1999), "Matrix", int64(42)}, Direction: cursorNext})
+
+	f := Filters{Sort: "-year,title", SortSafeList: safe, UseCursor: true, Cursor: encoded}
+	c, err := f.cursor()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Direction != cursorNext || fmt.Sprint(c.Values) != "[1999 Matrix 42]" {
+		t.Errorf("unexpected cursor %+v", c)
+	}
+
+	f.Sort = "title"
+	if _, err := f.cursor(); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected a cursor for another sort to be rejected, got %v", err)
+	}
+
+	for _, bad := range []string{
+		"not base64!",
+		"e30",
+		encodeCursor(cursor{Sort: "id", Values: []any{1}, Direction: "sideways"}),
+		encodeCursor(cursor{Sort: "-year,title", Values: []any{1999}, Direction: cursorNext}),
+		encodeCursor(cursor{Sort: "-year,title", Values: []any{"1999", "Matrix", 42}, Direction: cursorNext}),
+		encodeCursor(cursor{Sort: "-year,title", Values: []any{1999, 7, 42}, Direction: cursorNext}),
+		encodeCursor(cursor{Sort: "-year,title", Values: []any{1999, "Matrix", 4.2}, Direction: cursorNext}),
+		encodeCursor(cursor{Sort: "-year,title", Values: []any{1999, "Matrix", nil}, Direction: cursorNext}),
+	} {
+		f := Filters{Page: 1, PageSize: 20, Sort: "-year,title", SortSafeList: safe, UseCursor: true, Cursor: bad}
+		v := validator.New()
+		if ValidateFilters(v, f); v.Valid() {
+			t.Errorf("expected cursor %q to fail validation", bad)
+		}
+	}
+}
+
+func TestSortKeys(t *testing.T) {
+	safe := []string{"id", "title", "year", "-id", "-title", "-year"}
+
+	f := Filters{Sort: "-year,title", SortSafeList: safe}
+	if got := f.orderBy(); got != "year DESC, title ASC, id ASC" {
+		t.Errorf("unexpected order %q", got)
+	}
+	f.Sort = "-id"
+	if got := f.orderBy(); got != "id DESC" {
+		t.Errorf("expected no extra tie-breaker when sorting by id, got %q", got)
+	}
+
+	cond, args := keysetCondition([]sortKey{{column: "year", desc: true}, {column: "title"}, {column: "id"}}, []any{1999, "Matrix", 42}, []any{20})
+	want := "((year < $2) OR (year = $2 AND title > $3) OR (year = $2 AND title = $3 AND id > $4))"
+	if cond != want || len(args) != 4 {
+		t.Errorf("unexpected keyset condition %q %v", cond, args)
+	}
+
+	for _, sort := range []string{"year,-year", "rating", "title,year,id,-title"} {
+		v := validator.New()
+		if ValidateFilters(v, Filters{Page: 1, PageSize: 20, Sort: sort, SortSafeList: safe}); v.Valid() {
+			t.Errorf("expected sort %q to be rejected", sort)
+		}
+	}
+}
+
+func TestMovieFilterWhere(t *testing.T) {
+	where, args := MovieFilter{}.where(nil)
+	if where != "WHERE deleted_at IS NULL" || len(args) != 0 {
+		t.Errorf("unexpected empty filter %q %v", where, args)
+	}
+
+	f := MovieFilter{
+		Title:        "'; DROP TABLE movies; --",
+		GenresNone:   []string{"horror"},
+		YearMin:      1990,
+		RuntimeMax:   120,
+		IDs:          []int64{1, 2},
+		CollectionID: 3,
+	}
+	where, args = f.where([]any{20, 0})
+	want := "WHERE deleted_at IS NULL" +
+		" AND to_tsvector('simple', title) @@ plainto_tsquery('simple', $3)" +
+		" AND NOT genres && $4 AND year >= $5 AND runtime <= $6 AND id = ANY($7)" +
+		" AND id IN (SELECT movie_id FROM collection_movies WHERE collection_id = $8)"
+	if where != want {
+		t.Errorf("unexpected where clause\n got: %s\nwant: %s", where, want)
+	}
+	if len(args) != 8 || args[2] != f.Title {
+		t.Errorf("expected user input to be passed as arguments, got %v", args)
+	}
+}
+
+func TestValidateMovieFilter(t *testing.T) {
+	v := validator.New()
+	ValidateMovieFilter(v, MovieFilter{YearMin: 2000, YearMax: 1990, RuntimeMin: -1, IDs: []int64{0}})
+	for _, key := range []string{"year_max", "runtime_min", "ids"} {
+		if _, ok := v.Errors[key]; !ok {
+			t.Errorf("expected an error for %s, got %v", key, v.Errors)
+		}
+	}
+}
+
+func TestValidateCollection(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection Collection
+		wantErr    string
+	}{
+		{"valid", Collection{Name: "Star Wars", MovieIDs: []int64{4, 1, 2}}, ""},
+		{"empty membership", Collection{Name: "Star Wars", MovieIDs: []int64{}}, ""},
+		{"missing name", Collection{MovieIDs: []int64{1}}, "name"},
+		{"missing movies", Collection{Name: "Star Wars"}, "movie_ids"},
+		{"duplicate movie", Collection{Name: "Star Wars", MovieIDs: []int64{1, 2, 1}}, "movie_ids"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateCollection(v, &tt.collection)
+			if tt.wantErr == "" && !v.Valid() {
+				t.Errorf("unexpected errors %v", v.Errors)
+			}
+			if _, ok := v.Errors[tt.wantErr]; tt.wantErr != "" && !ok {
+				t.Errorf("expected an error for %s, got %v", tt.wantErr, v.Errors)
+			}
+		})
+	}
+}
+
+func TestSearchQuery(t *testing.T) {
+	tests := map[string]string{
+		"star wa":            "star & wa:*",
+		"  The   MATRIX ":    "the & matrix:*",
+		"o'brien & (x | y)!": "o & brien & x & y:*",
+		"amélie":             "amélie:*",
+		"!!!":                "",
+	}
+	for in, want := range tests {
+		if got := searchQuery(in); got != want {
+			t.Errorf("searchQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	v := validator.New()
+	ValidateMovieFilter(v, MovieFilter{Search: "?!"})
+	if _, ok := v.Errors["q"]; !ok {
+		t.Errorf("expected a query without words to be rejected, got %v", v.Errors)
+	}
+}
+
+func TestMovieSelect(t *testing.T) {
+	columns, dest := movieSelect([]string{"title", "external_id"})
+	if columns != "id, title, COALESCE(external_id, ''), version" {
+		t.Errorf("unexpected columns %q", columns)
+	}
+	var movie Movie
+	if got := dest(&movie); len(got) != 4 || got[1] != &movie.Title {
+		t.Errorf("unexpected scan destinations %v", got)
+	}
+
+	columns, _ = movieSelect(nil)
+	if columns != movieColumns {
+		t.Errorf("expected all columns without fields, got %q", columns)
+	}
+}
+
+func TestListFilterWhere(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   string
+		args   []any
+	}{
+		{
+			name:   "anonymous browsing",
+			filter: ListFilter{},
+			want:   "WHERE (visibility = 'public' OR user_id = $1)",
+			args:   []any{int64(0)},
+		},
+		{
+			name:   "another user's lists",
+			filter: ListFilter{ViewerID: 7, OwnerID: 3},
+			want:   "WHERE (visibility = 'public' OR user_id = $1) AND user_id = $2",
+			args:   []any{int64(7), int64(3)},
+		},
+		{
+			name:   "followed lists",
+			filter: ListFilter{ViewerID: 7, FollowedBy: 7},
+			want:   "WHERE id IN (SELECT list_id FROM list_follows WHERE user_id = $1) AND (visibility <> 'private' OR user_id = $2)",
+			args:   []any{int64(7), int64(7)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.filter.where(nil)
+			if where != tt.want {
+				t.Errorf("unexpected where clause\n got: %s\nwant: %s", where, tt.want)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("got args %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestValidateList(t *testing.T) {
+	v := validator.New()
+	ValidateList(v, &List{Title: "Top 10 horror", Visibility: ListUnlisted})
+	if !v.Valid() {
+		t.Errorf("unexpected errors %v", v.Errors)
+	}
+
+	v = validator.New()
+	ValidateList(v, &List{Visibility: "friends"})
+	for _, key := range []string{"title", "visibility"} {
+		if _, ok := v.Errors[key]; !ok {
+			t.Errorf("expected an error for %s, got %v", key, v.Errors)
+		}
+	}
+}
+
+func TestGenerateSlug(t *testing.T) {
+	a, err := generateSlug()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := generateSlug()
+	if len(a) != 26 || a == b || strings.ToLower(a) != a {
+		t.Errorf("expected distinct 26 character lowercase slugs, got %q and %q", a, b)
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := map[string]string{
+		"Time  Travel":   "time travel",
+		"  noir ":        "noir",
+		"Coming-of-Age":  "coming-of-age",
+		"\tslow\nburn\t": "slow burn",
+	}
+	for in, want := range tests {
+		if got := NormalizeTag(in); got != want {
+			t.Errorf("NormalizeTag(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    []string
+		wantErr bool
+	}{
+		{"valid", []string{"time travel", "director's cut", "coming-of-age", "東京"}, false},
+		{"empty", []string{}, true},
+		{"duplicate", []string{"noir", "noir"}, true},
+		{"punctuation", []string{"#noir"}, true},
+		{"too long", []string{strings.Repeat("a", 51)}, true},
+		{"too many", strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateTags(v, tt.tags)
+			if v.Valid() == tt.wantErr {
+				t.Errorf("got errors %v, wantErr %v", v.Errors, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMovieFilterWhereTags(t *testing.T) {
+	where, args := MovieFilter{Tags: []string{"noir", "heist"}}.where(nil)
+	if strings.Count(where, "movie_tags") != 2 || !strings.Contains(where, "name = $1") || !strings.Contains(where, "name = $2") {
+		t.Errorf("expected one clause per tag, got %s", where)
+	}
+	if !reflect.DeepEqual(args, []any{"noir", "heist"}) {
+		t.Errorf("got args %v", args)
+	}
+}
+
+func TestNormalizeLocale(t *testing.T) {
+	tests := map[string]string{
+		"fr":      "fr",
+		"PT_br":   "pt-BR",
+		" en-us":  "en-US",
+		"zh-Hant": "zh-hant",
+	}
+	for in, want := range tests {
+		got := NormalizeLocale(in)
+		if got != want {
+			t.Errorf("NormalizeLocale(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if LocaleRX.MatchString(NormalizeLocale("zh-Hant")) {
+		t.Error("expected script subtags to be rejected")
+	}
+}
+
+func TestBestTranslation(t *testing.T) {
+	fr := &MovieTranslation{Locale: "fr", Title: "Le Parrain"}
+	ptBR := &MovieTranslation{Locale: "pt-BR", Title: "O Poderoso Chefão"}
+	translations := []*MovieTranslation{fr, ptBR}
+
+	tests := []struct {
+		locales []string
+		want    *MovieTranslation
+	}{
+		{[]string{"pt-BR", "pt"}, ptBR},
+		{[]string{"fr-CA", "fr"}, fr},
+		{[]string{"de", "fr"}, fr},
+		{[]string{"pt-PT", "pt"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		if got := BestTranslation(translations, tt.locales); got != tt.want {
+			t.Errorf("BestTranslation(%v) = %v, want %v", tt.locales, got, tt.want)
+		}
+	}
+}
+
+func TestDateJSON(t *testing.T) {
+	var d Date
+	err := json.Unmarshal([]byte(`"2024-02-29"`), &d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, _ := json.Marshal(d)
+	if string(js) != `"2024-02-29"` {
+		t.Errorf("got %s", js)
+	}
+	for _, in := range []string{`"2023-02-29"`, `"29/02/2024"`, `20240229`} {
+		if err := json.Unmarshal([]byte(in), &d); !errors.Is(err, ErrInvalidDateFormat) {
+			t.Errorf("expected %s to be rejected, got %v", in, err)
+		}
+	}
+}
+
+func TestSimilarMovieJSON(t *testing.T) {
+	js, err := json.Marshal(SimilarMovie{Movie: &Movie{ID: 7, Title: "Heat", Runtime: 170}, Score: 0.75})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Movie map[string]any `json:"movie"`
+		Score float64        `json:"score"`
+	}
+	if err := json.Unmarshal(js, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Score != 0.75 || got.Movie["title"] != "Heat" || got.Movie["runtime"] != "170 mins" {
+		t.Errorf("unexpected JSON %s", js)
+	}
+}
+
+func TestValidateAvailability(t *testing.T) {
+	day := func(s string) Date {
+		t, _ := time.Parse("2006-01-02", s)
+		return Date{t}
+	}
+	end := day("2024-01-31")
+	before := day("2023-12-31")
+
+	tests := []struct {
+		name    string
+		a       Availability
+		wantErr []string
+	}{
+		{"open ended", Availability{Region: "US", Provider: "netflix", Type: "stream", StartsOn: day("2024-01-01")}, nil},
+		{"closed", Availability{Region: "GB", Provider: "prime-video", Type: "rent", StartsOn: day("2024-01-01"), EndsOn: &end}, nil},
+		{"single day", Availability{Region: "GB", Provider: "itunes", Type: "buy", StartsOn: end, EndsOn: &end}, nil},
+		{"ends before start", Availability{Region: "US", Provider: "netflix", Type: "stream", StartsOn: day("2024-01-01"), EndsOn: &before}, []string{"ends_on"}},
+		{"bad fields", Availability{Region: "USA", Provider: "Net Flix", Type: "free"}, []string{"region", "provider", "type", "starts_on"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateAvailability(v, &tt.a)
+			if len(v.Errors) != len(tt.wantErr) {
+				t.Errorf("got errors %v, want errors for %v", v.Errors, tt.wantErr)
+			}
+			for _, key := range tt.wantErr {
+				if _, ok := v.Errors[key]; !ok {
+					t.Errorf("expected an error for %s, got %v", key, v.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestMovieFilterWhereAvailability(t *testing.T) {
+	where, args := MovieFilter{AvailableIn: "FR", Provider: "canal-plus"}.where(nil)
+	want := "WHERE deleted_at IS NULL AND id IN (SELECT movie_id FROM movie_availability" +
+		" WHERE starts_on <= CURRENT_DATE AND (ends_on IS NULL OR ends_on >= CURRENT_DATE) AND region = $1 AND provider = $2)"
+	if where != want {
+		t.Errorf("unexpected where clause\n got: %s\nwant: %s", where, want)
+	}
+	if !reflect.DeepEqual(args, []any{"FR", "canal-plus"}) {
+		t.Errorf("got args %v", args)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title string
+		year  int32
+		want  string
+	}{
+		{"The Matrix", 1999, "the-matrix-1999"},
+		{"  Amélie: Le Fabuleux Destin!  ", 2001, "amélie-le-fabuleux-destin-2001"},
+		{"2001: A Space Odyssey", 1968, "2001-a-space-odyssey-1968"},
+		{"???", 2020, "movie-2020"},
+		{strings.Repeat("ab ", 50), 2000, strings.TrimRight(strings.Repeat("ab-", 27)[:80], "-") + "-2000"},
+	}
+	for _, tt := range tests {
+		if got := Slugify(tt.title, tt.year); got != tt.want {
+			t.Errorf("Slugify(%q, %d) = %q, want %q", tt.title, tt.year, got, tt.want)
+		}
+	}
+}
+
+func TestSlugHasBase(t *testing.T) {
+	tests := []struct {
+		slug string
+		want bool
+	}{
+		{"the-matrix-1999", true},
+		{"the-matrix-1999-2", true},
+		{"the-matrix-1999-12", true},
+		{"the-matrix-1999-1", false},
+		{"the-matrix-1999-02", false},
+		{"the-matrix-1999-reloaded", false},
+		{"the-matrix-2003", false},
+	}
+	for _, tt := range tests {
+		if got := slugHasBase(tt.slug, "the-matrix-1999"); got != tt.want {
+			t.Errorf("slugHasBase(%q) = %v, want %v", tt.slug, got, tt.want)
+		}
+	}
+}
+
+func TestPickSlug(t *testing.T) {
+	if got := pickSlug("heat-1995", map[string]bool{}); got != "heat-1995" {
+		t.Errorf("got %q, want heat-1995", got)
+	}
+	taken := map[string]bool{"heat-1995": true, "heat-1995-2": true, "heat-1995-4": true}
+	if got := pickSlug("heat-1995", taken); got != "heat-1995-3" {
+		t.Errorf("got %q, want heat-1995-3", got)
+	}
+}
+
+func TestSearchColumnsEscapeHighlights(t *testing.T) {
+	columns, _ := MovieFilter{Search: "matrix"}.searchColumns(nil)
+	for _, column := range []string{"title", "synopsis"} {
+		if !strings.Contains(columns, "ts_headline('simple', "+htmlEscape(column)+",") {
+			t.Errorf("expected the %s highlight to be built from escaped text:\n%s", column, columns)
+		}
+	}
+}
+
+func TestSearchColumnsHighlightTranslation(t *testing.T) {
+	columns, args := MovieFilter{Search: "matrice", Locales: []string{"fr-CA", "fr"}}.searchColumns(nil)
+	if len(args) != 3 {
+		t.Fatalf("got args %v, want the query, the text and the locales", args)
+	}
+	if !strings.Contains(columns, "COALESCE((SELECT t.title FROM movie_translations t") {
+		t.Errorf("expected the title highlight to use the translation:\n%s", columns)
+	}
+	if !strings.Contains(columns, "ORDER BY array_position($3::text[], t.locale)") {
+		t.Errorf("expected the translation to follow the locale preference:\n%s", columns)
+	}
+}
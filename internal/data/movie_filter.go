@@ -0,0 +1,203 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+const maxFilterIDs = 100
+
+// MovieFilter narrows down the movies returned by GetAll and Export. Zero
+// values mean the filter is not applied.
+type MovieFilter struct {
+	// Search is a free text query matched against the title and synopsis.
+	// Unlike Title it matches word prefixes and tolerates typos in the title.
+	Search       string
+	Title        string
+	Genres       []string
+	GenresAny    []string
+	GenresNone   []string
+	YearMin      int
+	YearMax      int
+	RuntimeMin   int
+	RuntimeMax   int
+	CreatedAfter time.Time
+	IDs          []int64
+	CollectionID int64
+	// Tags are normalized tag names that must all be on a movie.
+	Tags []string
+	// AvailableIn and Provider keep movies that can be watched today in a
+	// region and/or from a provider.
+	AvailableIn string
+	Provider    string
+	// Locales are the locales the results are shown in, most preferred
+	// first. They do not filter; search highlights are built from the same
+	// translation the response shows.
+	Locales []string
+}
+
+func ValidateMovieFilter(v *validator.Validator, f MovieFilter) {
+	if f.Search != "" {
+		v.Check(searchQuery(f.Search) != "", "q", "must contain at least one letter or digit")
+		v.Check(len(f.Search) <= 200, "q", "must not be more than 200 bytes long")
+	}
+	v.Check(f.YearMin >= 0, "year_min", "must not be negative")
+	v.Check(f.YearMax >= 0, "year_max", "must not be negative")
+	v.Check(f.YearMax == 0 || f.YearMin <= f.YearMax, "year_max", "must not be less than year_min")
+	v.Check(f.RuntimeMin >= 0, "runtime_min", "must not be negative")
+	v.Check(f.RuntimeMax >= 0, "runtime_max", "must not be negative")
+	v.Check(f.RuntimeMax == 0 || f.RuntimeMin <= f.RuntimeMax, "runtime_max", "must not be less than runtime_min")
+	v.Check(len(f.IDs) <= maxFilterIDs, "ids", "must not contain more than 100 ids")
+	v.Check(f.CollectionID >= 0, "collection", "must be a positive integer")
+	v.Check(len(f.Tags) <= MaxMovieTags, "tags", "must not contain more than 10 tags")
+	v.Check(f.AvailableIn == "" || validator.Matches(f.AvailableIn, RegionRX), "available_in", "must be a two letter ISO 3166 country code")
+	for _, id := range f.IDs {
+		if id < 1 {
+			v.AddError("ids", "must only contain positive integers")
+			break
+		}
+	}
+}
+
+// where returns the WHERE clause for the filter. Values are always passed as
+// query arguments, appended to args, and referenced by their placeholder.
+func (f MovieFilter) where(args []any) (string, []any) {
+	clauses := []string{"deleted_at IS NULL"}
+	add := func(format string, value any) {
+		args = append(args, value)
+		clauses = append(clauses, fmt.Sprintf(format, len(args)))
+	}
+
+	if f.Search != "" {
+		args = append(args, searchQuery(f.Search), f.Search)
+		// Translated titles and synopses are searched as well.
+		clauses = append(clauses, fmt.Sprintf(`(search_vector @@ to_tsquery('simple', $%[1]d) OR title %% $%[2]d
+			OR id IN (SELECT movie_id FROM movie_translations WHERE search_vector @@ to_tsquery('simple', $%[1]d) OR title %% $%[2]d))`,
+			len(args)-1, len(args)))
+	}
+	if f.Title != "" {
+		add("to_tsvector('simple', title) @@ plainto_tsquery('simple', $%d)", f.Title)
+	}
+	if len(f.Genres) > 0 {
+		add("genres @> $%d", pq.Array(f.Genres))
+	}
+	if len(f.GenresAny) > 0 {
+		add("genres && $%d", pq.Array(f.GenresAny))
+	}
+	if len(f.GenresNone) > 0 {
+		add("NOT genres && $%d", pq.Array(f.GenresNone))
+	}
+	if f.YearMin > 0 {
+		add("year >= $%d", f.YearMin)
+	}
+	if f.YearMax > 0 {
+		add("year <= $%d", f.YearMax)
+	}
+	if f.RuntimeMin > 0 {
+		add("runtime >= $%d", f.RuntimeMin)
+	}
+	if f.RuntimeMax > 0 {
+		add("runtime <= $%d", f.RuntimeMax)
+	}
+	if !f.CreatedAfter.IsZero() {
+		add("created_at > $%d", f.CreatedAfter)
+	}
+	if len(f.IDs) > 0 {
+		add("id = ANY($%d)", pq.Array(f.IDs))
+	}
+	if f.CollectionID > 0 {
+		add("id IN (SELECT movie_id FROM collection_movies WHERE collection_id = $%d)", f.CollectionID)
+	}
+	for _, tag := range f.Tags {
+		// A merged tag's name matches the tag it was merged into.
+		add(`id IN (SELECT mt.movie_id FROM movie_tags mt JOIN tags t ON t.id = mt.tag_id
+			WHERE t.id = (SELECT COALESCE(merged_into, id) FROM tags WHERE name = $%d) AND t.status IN ('pending', 'approved'))`, tag)
+	}
+	if f.AvailableIn != "" || f.Provider != "" {
+		// Region and provider must match the same window.
+		window := []string{"starts_on <= CURRENT_DATE", "(ends_on IS NULL OR ends_on >= CURRENT_DATE)"}
+		if f.AvailableIn != "" {
+			args = append(args, f.AvailableIn)
+			window = append(window, fmt.Sprintf("region = $%d", len(args)))
+		}
+		if f.Provider != "" {
+			args = append(args, f.Provider)
+			window = append(window, fmt.Sprintf("provider = $%d", len(args)))
+		}
+		clauses = append(clauses, "id IN (SELECT movie_id FROM movie_availability WHERE "+strings.Join(window, " AND ")+")")
+	}
+	return "WHERE " + strings.Join(clauses, " AND "), args
+}
+
+const (
+	FacetGenres = "genres"
+	FacetDecade = "decade"
+)
+
+var Facets = []string{FacetGenres, FacetDecade}
+
+// maxGenreFacets limits the genre facet to the most common genres.
+const maxGenreFacets = 50
+
+// FacetCount is the number of matching movies with a given facet value, a
+// genre name or the first year of a decade.
+type FacetCount struct {
+	Value any `json:"value"`
+	Count int `json:"count"`
+}
+
+// searchColumns returns the rank and highlight columns selected alongside a
+// movie. Without a search they are constants so the query shape stays the
+// same.
+func (f MovieFilter) searchColumns(args []any) (string, []any) {
+	if f.Search == "" {
+		return "0::real AS rank, '' AS title_highlight, '' AS synopsis_highlight", args
+	}
+	args = append(args, searchQuery(f.Search), f.Search)
+	query, raw := len(args)-1, len(args)
+	title, synopsis := "title", "synopsis"
+	if len(f.Locales) > 0 {
+		// The same translation BestTranslation picks. Its synopsis may be
+		// empty, in which case the original is shown.
+		args = append(args, pq.Array(f.Locales))
+		best := fmt.Sprintf(`FROM movie_translations t WHERE t.movie_id = movies.id AND t.locale = ANY($%[1]d::text[])
+			ORDER BY array_position($%[1]d::text[], t.locale) LIMIT 1`, len(args))
+		title = fmt.Sprintf(`COALESCE((SELECT t.title %s), title)`, best)
+		synopsis = fmt.Sprintf(`COALESCE((SELECT NULLIF(t.synopsis, '') %s), synopsis)`, best)
+	}
+	return fmt.Sprintf(`GREATEST(
+			ts_rank(search_vector, to_tsquery('simple', $%[1]d)) + similarity(title, $%[2]d),
+			(SELECT max(ts_rank(t.search_vector, to_tsquery('simple', $%[1]d)) + similarity(t.title, $%[2]d))
+				FROM movie_translations t WHERE t.movie_id = movies.id)
+		) AS rank,
+		ts_headline('simple', %[3]s, to_tsquery('simple', $%[1]d), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') AS title_highlight,
+		ts_headline('simple', %[4]s, to_tsquery('simple', $%[1]d), 'StartSel=<mark>, StopSel=</mark>, MaxWords=25, MinWords=10') AS synopsis_highlight`,
+		query, raw, htmlEscape(title), htmlEscape(synopsis)), args
+}
+
+// htmlEscape returns an SQL expression escaping expr for HTML. Highlights are
+// built from the escaped text so that the <mark> tags are the only markup in
+// them.
+func htmlEscape(expr string) string {
+	return `replace(replace(replace(replace(replace(` + expr +
+		`, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+}
+
+// searchQuery turns free text into a tsquery that requires every word, with
+// the last one matched as a prefix so partially typed words are found. Only
+// letters and digits are kept, so the result is always valid tsquery syntax.
+func searchQuery(q string) string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	words[len(words)-1] += ":*"
+	return strings.Join(words, " & ")
+}
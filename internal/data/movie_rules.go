@@ -0,0 +1,60 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// MovieRules are the limits ValidateMovie enforces on movies. They can be
+// configured, but only within MovieLimits.
+type MovieRules struct {
+	MaxTitleBytes int
+	MinGenres     int
+	MaxGenres     int
+	MinYear       int
+	// MaxFutureYears is how many years ahead of the current one announced
+	// releases may be dated.
+	MaxFutureYears int
+}
+
+// DefaultMovieRules are the rules used unless configured otherwise.
+var DefaultMovieRules = MovieRules{
+	MaxTitleBytes:  500,
+	MinGenres:      1,
+	MaxGenres:      5,
+	MinYear:        1888,
+	MaxFutureYears: 0,
+}
+
+// MovieLimits are the loosest rules allowed. The check constraints on the
+// movies and movie_translations tables enforce exactly these, so keep them
+// in step with the migrations; TestMovieLimitsMatchMigrations fails when they drift apart.
+var MovieLimits = MovieRules{
+	MaxTitleBytes:  1000,
+	MinGenres:      1,
+	MaxGenres:      10,
+	MinYear:        1888,
+	MaxFutureYears: 10,
+}
+
+// MaxYear is the latest year a movie may be dated this year.
+func (r MovieRules) MaxYear() int {
+	return time.Now().Year() + r.MaxFutureYears
+}
+
+// ValidateMovieRules checks that rules are consistent and no looser than
+// MovieLimits, so that movies passing ValidateMovie are never rejected by the
+// database.
+func ValidateMovieRules(v *validator.Validator, rules MovieRules) {
+	v.Check(rules.MaxTitleBytes > 0, "max_title_bytes", "must be greater than zero")
+	v.Check(rules.MaxTitleBytes <= MovieLimits.MaxTitleBytes, "max_title_bytes", fmt.Sprintf("must not be more than %d", MovieLimits.MaxTitleBytes))
+	v.Check(rules.MinGenres >= MovieLimits.MinGenres, "min_genres", fmt.Sprintf("must be at least %d", MovieLimits.MinGenres))
+	v.Check(rules.MaxGenres >= rules.MinGenres, "max_genres", "must not be less than min_genres")
+	v.Check(rules.MaxGenres <= MovieLimits.MaxGenres, "max_genres", fmt.Sprintf("must not be more than %d", MovieLimits.MaxGenres))
+	v.Check(rules.MinYear >= MovieLimits.MinYear, "min_year", fmt.Sprintf("must be at least %d", MovieLimits.MinYear))
+	v.Check(rules.MinYear <= rules.MaxYear(), "min_year", "must not be after the latest allowed year")
+	v.Check(rules.MaxFutureYears >= 0, "max_future_years", "must not be negative")
+	v.Check(rules.MaxFutureYears <= MovieLimits.MaxFutureYears, "max_future_years", fmt.Sprintf("must not be more than %d", MovieLimits.MaxFutureYears))
+}
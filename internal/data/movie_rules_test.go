@@ -0,0 +1,215 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+func TestValidateMovieRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   func(r *MovieRules)
+		wantErr []string
+	}{
+		{"defaults", func(r *MovieRules) {}, nil},
+		{"limits", func(r *MovieRules) { *r = MovieLimits }, nil},
+		{"announced releases", func(r *MovieRules) { r.MaxFutureYears = 3 }, nil},
+		{"looser than the database", func(r *MovieRules) {
+			r.MaxTitleBytes = MovieLimits.MaxTitleBytes + 1
+			r.MaxGenres = MovieLimits.MaxGenres + 1
+			r.MinYear = MovieLimits.MinYear - 1
+			r.MaxFutureYears = MovieLimits.MaxFutureYears + 1
+		}, []string{"max_title_bytes", "max_genres", "min_year", "max_future_years"}},
+		{"inconsistent", func(r *MovieRules) {
+			r.MaxTitleBytes = 0
+			r.MinGenres = 3
+			r.MaxGenres = 2
+			r.MinYear = time.Now().Year() + 1
+		}, []string{"max_title_bytes", "max_genres", "min_year"}},
+		{"negative", func(r *MovieRules) {
+			r.MinGenres = 0
+			r.MaxFutureYears = -1
+		}, []string{"min_genres", "max_future_years"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := DefaultMovieRules
+			tt.rules(&rules)
+			v := validator.New()
+			ValidateMovieRules(v, rules)
+			if len(v.Errors) != len(tt.wantErr) {
+				t.Errorf("got errors %v, want errors for %v", v.Errors, tt.wantErr)
+			}
+			for _, key := range tt.wantErr {
+				if _, ok := v.Errors[key]; !ok {
+					t.Errorf("expected an error for %s, got %v", key, v.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateMovieConfiguredRules(t *testing.T) {
+	year := time.Now().Year()
+	rules := MovieRules{MaxTitleBytes: 10, MinGenres: 2, MaxGenres: 3, MinYear: 1900, MaxFutureYears: 2}
+	valid := func() Movie {
+		return Movie{Title: "Dune", Year: int32(year), Runtime: 155, Genres: []string{"sci-fi", "drama"}}
+	}
+	tests := []struct {
+		name    string
+		change  func(m *Movie)
+		wantErr string
+	}{
+		{"valid", func(m *Movie) {}, ""},
+		{"announced release", func(m *Movie) { m.Year = int32(year + 2) }, ""},
+		{"too far ahead", func(m *Movie) { m.Year = int32(year + 3) }, "year"},
+		{"too early", func(m *Movie) { m.Year = 1899 }, "year"},
+		{"long title", func(m *Movie) { m.Title = "Dune: Part Two" }, "title"},
+		{"too few genres", func(m *Movie) { m.Genres = []string{"sci-fi"} }, "genres"},
+		{"too many genres", func(m *Movie) { m.Genres = []string{"sci-fi", "drama", "action", "adventure"} }, "genres"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := valid()
+			tt.change(&movie)
+			v := validator.New()
+			ValidateMovie(v, &movie, rules)
+			if tt.wantErr == "" && !v.Valid() {
+				t.Errorf("expected validation to pass, got errors: %v", v.Errors)
+			}
+			if tt.wantErr != "" && (len(v.Errors) != 1 || v.Errors[tt.wantErr] == "") {
+				t.Errorf("expected only an error for %s, got %v", tt.wantErr, v.Errors)
+			}
+		})
+	}
+
+	v := validator.New()
+	movie := valid()
+	movie.Year = int32(year + 3)
+	ValidateMovie(v, &movie, rules)
+	if want := "must not be more than 2 years in the future"; v.Errors["year"] != want {
+		t.Errorf("got year error %q, want %q", v.Errors["year"], want)
+	}
+}
+
+// movieConstraints returns the check constraints on the movies and
+// movie_translations tables as the migrations leave them, keyed by name.
+func movieConstraints(t *testing.T) map[string]string {
+	t.Helper()
+	files, err := filepath.Glob("../../migrations/*.up.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	add := regexp.MustCompile(`ALTER TABLE (?:movies|movie_translations) ADD CONSTRAINT (\w+) (CHECK \(.*\));`)
+	drop := regexp.MustCompile(`ALTER TABLE (?:movies|movie_translations) DROP CONSTRAINT IF EXISTS (\w+);`)
+
+	constraints := make(map[string]string)
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(string(sql), "\n") {
+			if m := drop.FindStringSubmatch(line); m != nil {
+				delete(constraints, m[1])
+			}
+			if m := add.FindStringSubmatch(line); m != nil {
+				constraints[m[1]] = m[2]
+			}
+		}
+	}
+	return constraints
+}
+
+func TestMovieLimitsMatchMigrations(t *testing.T) {
+	constraints := movieConstraints(t)
+	want := map[string]string{
+		"movies_year_check": fmt.Sprintf("CHECK (year BETWEEN %d AND date_part('year', now()) + %d)",
+			MovieLimits.MinYear, MovieLimits.MaxFutureYears),
+		"genres_length_check": fmt.Sprintf("CHECK (cardinality(genres) BETWEEN %d AND %d)",
+			MovieLimits.MinGenres, MovieLimits.MaxGenres),
+		"movies_title_length_check":             fmt.Sprintf("CHECK (octet_length(title) <= %d)", MovieLimits.MaxTitleBytes),
+		"movie_translations_title_length_check": fmt.Sprintf("CHECK (octet_length(title) <= %d)", MovieLimits.MaxTitleBytes),
+	}
+	for name, def := range want {
+		if constraints[name] != def {
+			t.Errorf("constraint %s is %q in the migrations, MovieLimits expects %q", name, constraints[name], def)
+		}
+	}
+}
+
+// TestMovieRulesAgreeWithDatabase inserts movies on either side of every limit
+// and checks that the database accepts exactly those ValidateMovie accepts
+// under MovieLimits. It needs a migrated database in TEST_DATABASE_URL.
+func TestMovieRulesAgreeWithDatabase(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var year int
+	if err := db.QueryRow(`SELECT date_part('year', now())::int`).Scan(&year); err != nil {
+		t.Fatal(err)
+	}
+	genres := func(n int) []string {
+		g := make([]string, n)
+		for i := range g {
+			g[i] = fmt.Sprintf("genre-%d", i)
+		}
+		return g
+	}
+	tests := []struct {
+		name   string
+		change func(m *Movie)
+	}{
+		{"valid", func(m *Movie) {}},
+		{"longest title", func(m *Movie) { m.Title = strings.Repeat("a", MovieLimits.MaxTitleBytes) }},
+		{"title too long", func(m *Movie) { m.Title = strings.Repeat("a", MovieLimits.MaxTitleBytes+1) }},
+		{"multibyte title too long", func(m *Movie) { m.Title = strings.Repeat("é", MovieLimits.MaxTitleBytes/2+1) }},
+		{"earliest year", func(m *Movie) { m.Year = int32(MovieLimits.MinYear) }},
+		{"year too early", func(m *Movie) { m.Year = int32(MovieLimits.MinYear - 1) }},
+		{"latest year", func(m *Movie) { m.Year = int32(year + MovieLimits.MaxFutureYears) }},
+		{"year too late", func(m *Movie) { m.Year = int32(year + MovieLimits.MaxFutureYears + 1) }},
+		{"no genres", func(m *Movie) { m.Genres = []string{} }},
+		{"fewest genres", func(m *Movie) { m.Genres = genres(MovieLimits.MinGenres) }},
+		{"most genres", func(m *Movie) { m.Genres = genres(MovieLimits.MaxGenres) }},
+		{"too many genres", func(m *Movie) { m.Genres = genres(MovieLimits.MaxGenres + 1) }},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			movie := Movie{Title: "Rules", Year: int32(year), Runtime: 90, Genres: []string{"drama"}}
+			tt.change(&movie)
+			v := validator.New()
+			ValidateMovie(v, &movie, MovieLimits)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			_, err = tx.Exec(`INSERT INTO movies (title, slug, year, runtime, genres) VALUES ($1, $2, $3, $4, $5)`,
+				movie.Title, fmt.Sprintf("movie-rules-test-%d", i), movie.Year, movie.Runtime, pq.Array(movie.Genres))
+			if err != nil && !strings.Contains(err.Error(), "violates check constraint") {
+				t.Fatal(err)
+			}
+
+			if v.Valid() != (err == nil) {
+				t.Errorf("ValidateMovie accepts it: %v (%v), the database accepts it: %v (%v)", v.Valid(), v.Errors, err == nil, err)
+			}
+		})
+	}
+}
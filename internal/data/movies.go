@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
@@ -13,13 +15,26 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   int32     `json:"-"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID           int64        `json:"id"`
+	CreatedAt    time.Time    `json:"-"`
+	Title        string       `json:"title"`
+	Slug         string       `json:"slug,omitempty"`
+	Year         int32        `json:"year,omitempty"`
+	Runtime      int32        `json:"-"`
+	Genres       []string     `json:"genres,omitempty"`
+	Synopsis     string       `json:"synopsis,omitempty"`
+	PosterURL    string       `json:"poster_url,omitempty"`
+	ThumbnailURL string       `json:"poster_thumbnail_url,omitempty"`
+	ExternalID   string       `json:"external_id,omitempty"`
+	Search       *SearchMatch `json:"search,omitempty"`
+	// Locale is set when Title and Synopsis have been replaced by a
+	// translation. Collection and Tags are not stored on the movie either;
+	// handlers attach them when responding.
+	Locale     string           `json:"locale,omitempty"`
+	Collection *MovieCollection `json:"collection,omitempty"`
+	Tags       []TagCount       `json:"tags,omitempty"`
+	DeletedAt  *time.Time       `json:"deleted_at,omitempty"`
+	Version    int32            `json:"version"`
 }
 
 func (m Movie) MarshalJSON() ([]byte, error) {
@@ -40,52 +55,256 @@ func (m Movie) MarshalJSON() ([]byte, error) {
 	return json.Marshal(aux)
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+func ValidateMovie(v *validator.Validator, movie *Movie, rules MovieRules) {
 	v.Check(movie.Title != "", "title", "must be provided")
-	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
+	v.Check(len(movie.Title) <= rules.MaxTitleBytes, "title", fmt.Sprintf("must not be more than %d bytes long", rules.MaxTitleBytes))
 	v.Check(movie.Year != 0, "year", "must be provided")
-	v.Check(movie.Year >= 1888, "year", "must be greater than 1888")
-	v.Check(movie.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.Check(int(movie.Year) >= rules.MinYear, "year", fmt.Sprintf("must be greater than %d", rules.MinYear))
+	if rules.MaxFutureYears == 0 {
+		v.Check(int(movie.Year) <= rules.MaxYear(), "year", "must not be in the future")
+	} else {
+		v.Check(int(movie.Year) <= rules.MaxYear(), "year", fmt.Sprintf("must not be more than %d years in the future", rules.MaxFutureYears))
+	}
 	v.Check(movie.Runtime != 0, "runtime", "must be provided")
 	v.Check(movie.Runtime > 0, "runtime", "must be a positive integer")
 	v.Check(movie.Genres != nil, "genres", "must be provided")
-	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
+	if rules.MinGenres == 1 {
+		v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
+	} else {
+		v.Check(len(movie.Genres) >= rules.MinGenres, "genres", fmt.Sprintf("must contain at least %d genres", rules.MinGenres))
+	}
+	v.Check(len(movie.Genres) <= rules.MaxGenres, "genres", fmt.Sprintf("must not contain more than %d genres", rules.MaxGenres))
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+	v.Check(len(movie.Synopsis) <= 5000, "synopsis", "must not be more than 5000 bytes long")
+}
+
+// SearchMatch describes how a movie matched a full-text search. The
+// highlights mark matching words with <mark> tags.
+type SearchMatch struct {
+	Rank              float64 `json:"rank"`
+	TitleHighlight    string  `json:"title_highlight"`
+	SynopsisHighlight string  `json:"synopsis_highlight,omitempty"`
+}
+
+// scanSearch returns the scan destinations for the columns added by
+// MovieFilter.searchColumns. The match is dropped again by keepSearch when
+// there was no search.
+func scanSearch(movie *Movie) []any {
+	movie.Search = &SearchMatch{}
+	return []any{&movie.Search.Rank, &movie.Search.TitleHighlight, &movie.Search.SynopsisHighlight}
+}
+
+func keepSearch(movie *Movie, filter MovieFilter) {
+	if filter.Search == "" {
+		movie.Search = nil
+	}
 }
 
 type MovieModel struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func (m MovieModel) Insert(movie *Movie) error {
-	query := `
-		INSERT INTO movies (title, year, runtime, genres)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, created_at, version`
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+// MovieFields are the fields of a movie that can be requested in a sparse
+// fieldset, in the order they are selected.
+var MovieFields = []string{
+	"id", "title", "slug", "year", "runtime", "genres", "synopsis",
+	"poster_url", "poster_thumbnail_url", "external_id", "version",
+}
+
+// movieSelect returns the columns to read for the given fields and a matching
+// movieDest. id and version are always read since ETags and cursors depend on
+// them. No fields means the whole movie.
+func movieSelect(fields []string) (string, func(*Movie) []any) {
+	if len(fields) == 0 {
+		return movieColumns, movieDest
+	}
+	var selected []string
+	for _, field := range MovieFields {
+		if field == "id" || field == "version" || slices.Contains(fields, field) {
+			selected = append(selected, field)
+		}
+	}
+
+	columns := make([]string, len(selected))
+	for i, field := range selected {
+		columns[i] = field
+		if field == "external_id" {
+			columns[i] = "COALESCE(external_id, '')"
+		}
+	}
+	dest := func(movie *Movie) []any {
+		dest := make([]any, len(selected))
+		for i, field := range selected {
+			switch field {
+			case "id":
+				dest[i] = &movie.ID
+			case "title":
+				dest[i] = &movie.Title
+			case "slug":
+				dest[i] = &movie.Slug
+			case "year":
+				dest[i] = &movie.Year
+			case "runtime":
+				dest[i] = &movie.Runtime
+			case "genres":
+				dest[i] = pq.Array(&movie.Genres)
+			case "synopsis":
+				dest[i] = &movie.Synopsis
+			case "poster_url":
+				dest[i] = &movie.PosterURL
+			case "poster_thumbnail_url":
+				dest[i] = &movie.ThumbnailURL
+			case "external_id":
+				dest[i] = &movie.ExternalID
+			case "version":
+				dest[i] = &movie.Version
+			}
+		}
+		return dest
+	}
+	return strings.Join(columns, ", "), dest
+}
+
+// movieColumns are the columns read for a movie, in the order expected by
+// movieDest.
+const movieColumns = `id, created_at, title, slug, year, runtime, genres, synopsis, poster_url, poster_thumbnail_url,
+	COALESCE(external_id, ''), deleted_at, version`
 
+func movieDest(movie *Movie) []any {
+	return []any{
+		&movie.ID,
+		&movie.CreatedAt,
+		&movie.Title,
+		&movie.Slug,
+		&movie.Year,
+		&movie.Runtime,
+		pq.Array(&movie.Genres),
+		&movie.Synopsis,
+		&movie.PosterURL,
+		&movie.ThumbnailURL,
+		&movie.ExternalID,
+		&movie.DeletedAt,
+		&movie.Version,
+	}
+}
+
+func (m MovieModel) Insert(movie *Movie) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+
+	return m.withSlugRetry(ctx, []*Movie{movie}, func() error {
+		query := `
+			INSERT INTO movies (title, slug, year, runtime, genres, synopsis, external_id)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+			RETURNING id, created_at, version`
+		args := []any{movie.Title, movie.Slug, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.Synopsis, movie.ExternalID}
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	})
+}
+
+// maxInsertBatch keeps multi-row inserts well below PostgreSQL's limit of
+// 65535 bind parameters per statement.
+const maxInsertBatch = 1000
+
+// InsertMany inserts movies using one multi-row INSERT per batch of rows and
+// fills in their id, created_at and version.
+func (m MovieModel) InsertMany(movies []*Movie) error {
+	for start := 0; start < len(movies); start += maxInsertBatch {
+		batch := movies[start:min(start+maxInsertBatch, len(movies))]
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := m.insertBatch(ctx, batch)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
+
+func (m MovieModel) insertBatch(ctx context.Context, batch []*Movie) error {
+	// The ids are taken from the sequence up front because the order of the
+	// rows returned by a multi-row INSERT is not guaranteed. Matching them by
+	// id instead tells which row belongs to which movie.
+	query := `SELECT nextval(pg_get_serial_sequence('movies', 'id')) FROM generate_series(1, $1)`
+	rows, err := m.DB.QueryContext(ctx, query, len(batch))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	byID := make(map[int64]*Movie, len(batch))
+	for i := 0; rows.Next(); i++ {
+		err := rows.Scan(&batch[i].ID)
+		if err != nil {
+			return err
+		}
+		byID[batch[i].ID] = batch[i]
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return m.withSlugRetry(ctx, batch, func() error {
+		var values strings.Builder
+		args := make([]any, 0, len(batch)*7)
+		for i, movie := range batch {
+			if i > 0 {
+				values.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&values, "($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+			args = append(args, movie.ID, movie.Title, movie.Slug, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.Synopsis)
+		}
+		query := `
+			INSERT INTO movies (id, title, slug, year, runtime, genres, synopsis)
+			VALUES ` + values.String() + `
+			RETURNING id, created_at, version`
+
+		rows, err := m.DB.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int64
+			var createdAt time.Time
+			var version int32
+			err := rows.Scan(&id, &createdAt, &version)
+			if err != nil {
+				return err
+			}
+			byID[id].CreatedAt = createdAt
+			byID[id].Version = version
+		}
+		return rows.Err()
+	})
+}
+
 func (m MovieModel) Get(id int64) (*Movie, error) {
+	return m.GetFields(id, nil)
+}
+
+// Exists reports whether a movie with the id exists, in the trash or not.
+func (m MovieModel) Exists(id int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM movies WHERE id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// GetFields is like Get but only reads the given fields, see movieSelect.
+func (m MovieModel) GetFields(id int64, fields []string) (*Movie, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
-	query := `SELECT id, created_at, title, year, runtime, genres, version FROM movies WHERE id = $1`
+	columns, dest := movieSelect(fields)
+	query := `SELECT ` + columns + ` FROM movies WHERE id = $1 AND deleted_at IS NULL`
 	var movie Movie
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&movie.ID,
-		&movie.CreatedAt,
-		&movie.Title,
-		&movie.Year,
-		&movie.Runtime,
-		pq.Array(&movie.Genres),
-		&movie.Version,
-	)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(dest(&movie)...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -97,16 +316,110 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	return &movie, nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
-	query := fmt.Sprintf(`SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
-		FROM movies	
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple',$1) OR $1 = '' )
-		AND (genres @> $2 OR $2 ='{}')
-		ORDER BY %s %s,id ASC LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+// GetByExternalID looks up a movie by the id it has in an external catalogue.
+// Movies in the trash are returned too, with DeletedAt set.
+func (m MovieModel) GetByExternalID(externalID string) (*Movie, error) {
+	query := `SELECT ` + movieColumns + ` FROM movies WHERE external_id = $1`
+	var movie Movie
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, externalID).Scan(movieDest(&movie)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
+
+// ExistingExternalIDs returns which of the given external ids are already
+// used by a movie.
+func (m MovieModel) ExistingExternalIDs(externalIDs []string) (map[string]bool, error) {
+	query := `SELECT external_id FROM movies WHERE external_id = ANY($1)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(externalIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		existing[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// MovieSuggestion is a compact movie used for typeahead suggestions.
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// Suggest returns up to limit movies for a partially typed title. Titles
+// starting with q come first, followed by close trigram matches so small typos
+// still produce suggestions.
+func (m MovieModel) Suggest(q string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+		SELECT id, title, year
+		FROM movies
+		WHERE deleted_at IS NULL AND (lower(title) LIKE $1 OR title % $2)
+		ORDER BY lower(title) LIKE $1 DESC, similarity(title, $2) DESC, title ASC, id ASC
+		LIMIT $3`
+	pattern := likeEscaper.Replace(strings.ToLower(q)) + "%"
 
-	args := []any{title, pq.Array(genres), filters.limit(), filters.offset()}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pattern, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	suggestions := []*MovieSuggestion{}
+	for rows.Next() {
+		var s MovieSuggestion
+		err := rows.Scan(&s.ID, &s.Title, &s.Year)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (m MovieModel) GetAll(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	if filters.UseCursor {
+		return m.getAllByCursor(filter, filters)
+	}
+	columns, dest := movieSelect(filters.Fields)
+	search, args := filter.searchColumns([]any{filters.limit(), filters.offset()})
+	where, args := filter.where(args)
+	query := fmt.Sprintf(`SELECT count(*) OVER(), %s, %s
+		FROM movies
+		%s
+		ORDER BY %s LIMIT $1 OFFSET $2`, columns, search, where, filters.orderBy())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
 
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -117,19 +430,12 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	totalRecords := 0
 	for rows.Next() {
 		var movie Movie
-		err := rows.Scan(
-			&totalRecords,
-			&movie.ID,
-			&movie.CreatedAt,
-			&movie.Title,
-			&movie.Year,
-			&movie.Runtime,
-			pq.Array(&movie.Genres),
-			&movie.Version,
-		)
+		row := append([]any{&totalRecords}, dest(&movie)...)
+		err := rows.Scan(append(row, scanSearch(&movie)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		keepSearch(&movie, filter)
 		movies = append(movies, &movie)
 	}
 	if err = rows.Err(); err != nil {
@@ -139,41 +445,450 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	return movies, metadata, nil
 }
 
+// Facets counts the movies matching filter per value of each of the named
+// facets, using the same conditions as GetAll.
+func (m MovieModel) Facets(filter MovieFilter, names []string) (map[string][]FacetCount, error) {
+	where, args := filter.where(nil)
+	facets := make(map[string][]FacetCount, len(names))
+	for _, name := range names {
+		var query string
+		switch name {
+		case FacetGenres:
+			query = fmt.Sprintf(`SELECT genre, count(*)
+				FROM movies CROSS JOIN LATERAL unnest(genres) AS genre
+				%s
+				GROUP BY genre
+				ORDER BY count(*) DESC, genre ASC
+				LIMIT %d`, where, maxGenreFacets)
+		case FacetDecade:
+			query = `SELECT year / 10 * 10 AS decade, count(*)
+				FROM movies
+				` + where + `
+				GROUP BY decade
+				ORDER BY decade ASC`
+		default:
+			return nil, fmt.Errorf("unknown facet %q", name)
+		}
+		counts, err := m.facetCounts(query, args)
+		if err != nil {
+			return nil, err
+		}
+		facets[name] = counts
+	}
+	return facets, nil
+}
+
+func (m MovieModel) facetCounts(query string, args []any) ([]FacetCount, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := []FacetCount{}
+	for rows.Next() {
+		var fc FacetCount
+		err := rows.Scan(&fc.Value, &fc.Count)
+		if err != nil {
+			return nil, err
+		}
+		if b, ok := fc.Value.([]byte); ok {
+			fc.Value = string(b)
+		}
+		counts = append(counts, fc)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// getAllByCursor is the keyset pagination variant of GetAll. Instead of
+// skipping rows with OFFSET it continues from the sort values stored in the
+// cursor, so deep pages are as cheap as the first one and rows inserted
+// meanwhile do not shift the results.
+func (m MovieModel) getAllByCursor(filter MovieFilter, filters Filters) ([]*Movie, Metadata, error) {
+	c, err := filters.cursor()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	keys := filters.sortKeys()
+	backwards := c != nil && c.Direction == cursorPrev
+
+	// Walking backwards reverses the order of every sort key; the rows are
+	// put back in order below.
+	order := keys
+	if backwards {
+		order = make([]sortKey, len(keys))
+		for i, k := range keys {
+			order[i] = sortKey{column: k.column, desc: !k.desc}
+		}
+	}
+
+	// The cursor needs the sort values of the first and last rows.
+	fields := filters.Fields
+	if len(fields) > 0 {
+		fields = slices.Clone(fields)
+		for _, k := range keys {
+			fields = append(fields, k.column)
+		}
+	}
+	columns, dest := movieSelect(fields)
+	search, args := filter.searchColumns([]any{filters.limit() + 1})
+	where, args := filter.where(args)
+	countWhere, countArgs := filter.where(nil)
+	if c != nil {
+		var keyset string
+		keyset, args = keysetCondition(order, c.Values, args)
+		where += " AND " + keyset
+	}
+
+	query := fmt.Sprintf(`SELECT %s, %s
+		FROM movies
+		%s
+		ORDER BY %s LIMIT $1`, columns, search, where, orderBy(order))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(append(dest(&movie), scanSearch(&movie)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		keepSearch(&movie, filter)
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	more := len(movies) > filters.limit()
+	if more {
+		movies = movies[:filters.limit()]
+	}
+	if backwards {
+		slices.Reverse(movies)
+	}
+
+	metadata := Metadata{PageSize: filters.PageSize}
+	if len(movies) > 0 {
+		first, last := movies[0], movies[len(movies)-1]
+		// Going backwards there is always a next page, and going forwards
+		// there is a previous page whenever we started from a cursor.
+		if more || backwards {
+			metadata.NextCursor = encodeCursor(cursor{Sort: filters.Sort, Values: movieSortValues(last, keys), Direction: cursorNext})
+		}
+		if (backwards && more) || (!backwards && c != nil) {
+			metadata.PrevCursor = encodeCursor(cursor{Sort: filters.Sort, Values: movieSortValues(first, keys), Direction: cursorPrev})
+		}
+	}
+
+	if !filters.SkipCount {
+		query := `SELECT count(*) FROM movies ` + countWhere
+		err = m.DB.QueryRowContext(ctx, query, countArgs...).Scan(&metadata.TotalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+	return movies, metadata, nil
+}
+
+// movieSortValues returns the values of the sort keys for movie, as stored in
+// a pagination cursor.
+func movieSortValues(movie *Movie, keys []sortKey) []any {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		switch k.column {
+		case "title":
+			values[i] = movie.Title
+		case "year":
+			values[i] = movie.Year
+		case "runtime":
+			values[i] = movie.Runtime
+		default:
+			values[i] = movie.ID
+		}
+	}
+	return values
+}
+
+// GetAllForSimilarity returns the id, year and genres of every movie that is
+// not in the trash.
+func (m MovieModel) GetAllForSimilarity() ([]*Movie, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT id, year, genres FROM movies WHERE deleted_at IS NULL`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	movies := []*Movie{}
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(&movie.ID, &movie.Year, pq.Array(&movie.Genres))
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
+}
+
+// exportFetchSize is the number of rows fetched from the export cursor at a
+// time.
+const exportFetchSize = 500
+
+// Export calls fn for every movie matching filter, in id order. Rows are read
+// through a server-side cursor in small batches so the result set is never
+// held in memory, and the query stops as soon as ctx is cancelled or fn
+// returns an error.
+func (m MovieModel) Export(ctx context.Context, filter MovieFilter, fn func(*Movie) error) error {
+	tx := m.DB
+	if db, ok := m.DB.(*sql.DB); ok {
+		// Cursors only live inside a transaction.
+		t, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return err
+		}
+		defer t.Rollback()
+		tx = t
+	}
+
+	where, args := filter.where(nil)
+	query := `DECLARE movies_export NO SCROLL CURSOR FOR
+		SELECT ` + movieColumns + `
+		FROM movies
+		` + where + `
+		ORDER BY id ASC`
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer tx.ExecContext(context.Background(), `CLOSE movies_export`)
+
+	fetch := fmt.Sprintf(`FETCH FORWARD %d FROM movies_export`, exportFetchSize)
+	for {
+		n, err := m.exportBatch(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+func (m MovieModel) exportBatch(ctx context.Context, tx DBTX, fetch string, fn func(*Movie) error) (int, error) {
+	rows, err := tx.QueryContext(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	n := 0
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(movieDest(&movie)...)
+		if err != nil {
+			return n, err
+		}
+		n++
+		err = fn(&movie)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// Update saves the movie. When the title or year changed so that the slug no
+// longer matches, the movie gets a new slug and the old one is kept to
+// redirect from.
 func (m MovieModel) Update(movie *Movie) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	oldSlug := movie.Slug
+	query := `
+		WITH updated AS (
+			UPDATE movies
+			SET title = $1, slug = $2, year = $3, runtime = $4, genres = $5, synopsis = $6, poster_url = $7,
+				poster_thumbnail_url = $8, version = version + 1
+			WHERE id = $9 AND version = $10 AND deleted_at IS NULL
+			RETURNING version
+		), retired AS (
+			INSERT INTO movie_slugs (slug, movie_id)
+			SELECT $11, $9 FROM updated WHERE $11 <> $2 AND $11 <> ''
+			ON CONFLICT (slug) DO UPDATE SET movie_id = EXCLUDED.movie_id
+		), reclaimed AS (
+			DELETE FROM movie_slugs WHERE slug = $2 AND movie_id = $9 AND EXISTS (SELECT 1 FROM updated)
+		)
+		SELECT version FROM updated`
+
+	err := m.withSlugRetry(ctx, []*Movie{movie}, func() error {
+		args := []any{
+			movie.Title,
+			movie.Slug,
+			movie.Year,
+			movie.Runtime,
+			pq.Array(movie.Genres),
+			movie.Synopsis,
+			movie.PosterURL,
+			movie.ThumbnailURL,
+			movie.ID,
+			movie.Version,
+			oldSlug,
+		}
+		return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete moves a movie to the trash. Like Update it only succeeds if the
+// movie is still at the version the caller last read.
+func (m MovieModel) Delete(movie *Movie) error {
 	query := `
 		UPDATE movies
-		SET title = $1, year = $2, runtime = $3, genres = $4, version = version + 1
-		WHERE id = $5 AND version = $6
-		RETURNING version`
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		RETURNING deleted_at, version`
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&movie.Version)
+	err := m.DB.QueryRowContext(ctx, query, movie.ID, movie.Version).Scan(&movie.DeletedAt, &movie.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
 }
-func (m MovieModel) Delete(id int64) error {
+
+func (m MovieModel) GetDeleted(id int64) (*Movie, error) {
 	if id < 1 {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	}
-	query := `DELETE FROM movies
-			WHERE id = $1`
+	query := `SELECT ` + movieColumns + ` FROM movies WHERE id = $1 AND deleted_at IS NOT NULL`
+	var movie Movie
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(movieDest(&movie)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &movie, nil
+}
 
+func (m MovieModel) GetAllDeleted(filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), `+movieColumns+`
+		FROM movies
+		WHERE deleted_at IS NOT NULL
+		ORDER BY %s LIMIT $1 OFFSET $2`, filters.orderBy())
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, id)
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
 	if err != nil {
-		return err
+		return nil, Metadata{}, err
 	}
+	defer rows.Close()
+	movies := []*Movie{}
+	totalRecords := 0
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(append([]any{&totalRecords}, movieDest(&movie)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return movies, metadata, nil
+}
 
-	rowsAf, err := result.RowsAffected()
+// Restore takes a movie out of the trash, subject to the same version check
+// as Update.
+func (m MovieModel) Restore(movie *Movie) error {
+	query := `
+		UPDATE movies
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND version = $2 AND deleted_at IS NOT NULL
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, movie.ID, movie.Version).Scan(&movie.Version)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
 	}
+	movie.DeletedAt = nil
+	return nil
+}
 
-	if rowsAf == 0 {
-		return ErrRecordNotFound
-	}
+// Purge permanently removes movies that were moved to the trash before the
+// given time and returns them with their id and poster URLs set, so the
+// caller can remove the stored images.
+func (m MovieModel) Purge(before time.Time) ([]*Movie, error) {
+	query := `DELETE FROM movies
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			RETURNING id, poster_url, poster_thumbnail_url`
 
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var movies []*Movie
+	for rows.Next() {
+		var movie Movie
+		err := rows.Scan(&movie.ID, &movie.PosterURL, &movie.ThumbnailURL)
+		if err != nil {
+			return nil, err
+		}
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return movies, nil
 }
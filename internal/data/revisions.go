@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	RevisionCreate  = "create"
+	RevisionUpdate  = "update"
+	RevisionDelete  = "delete"
+	RevisionRestore = "restore"
+	RevisionRevert  = "revert"
+)
+
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+type MovieRevision struct {
+	ID        int64                  `json:"id"`
+	MovieID   int64                  `json:"movie_id"`
+	Version   int32                  `json:"version"`
+	Action    string                 `json:"action"`
+	UserID    *int64                 `json:"user_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Changes   map[string]FieldChange `json:"changes"`
+	Snapshot  *Movie                 `json:"-"`
+}
+
+// movieSnapshot is the stored form of a movie at a given version. Unlike the
+// API representation it keeps runtime as a plain number of minutes.
+type movieSnapshot struct {
+	Title        string   `json:"title"`
+	Year         int32    `json:"year"`
+	Runtime      int32    `json:"runtime"`
+	Genres       []string `json:"genres"`
+	Synopsis     string   `json:"synopsis"`
+	PosterURL    string   `json:"poster_url"`
+	ThumbnailURL string   `json:"poster_thumbnail_url"`
+}
+
+// NewMovieRevision describes the change from before to after made by the
+// given user. before is nil for newly created movies and userID is 0 when no
+// user is known.
+func NewMovieRevision(action string, userID int64, before, after *Movie) *MovieRevision {
+	rev := &MovieRevision{
+		MovieID:  after.ID,
+		Version:  after.Version,
+		Action:   action,
+		Changes:  DiffMovies(before, after),
+		Snapshot: after,
+	}
+	if userID != 0 {
+		rev.UserID = &userID
+	}
+	return rev
+}
+
+// DiffMovies returns the user visible fields that differ between before and
+// after, keyed by their JSON name. A nil before is treated as an empty movie.
+func DiffMovies(before, after *Movie) map[string]FieldChange {
+	if before == nil {
+		before = &Movie{}
+	}
+	changes := make(map[string]FieldChange)
+	if before.Title != after.Title {
+		changes["title"] = FieldChange{From: nilIfZero(before.Title), To: nilIfZero(after.Title)}
+	}
+	if before.Year != after.Year {
+		changes["year"] = FieldChange{From: nilIfZero(before.Year), To: nilIfZero(after.Year)}
+	}
+	if before.Runtime != after.Runtime {
+		changes["runtime"] = FieldChange{From: formatRuntime(before.Runtime), To: formatRuntime(after.Runtime)}
+	}
+	if !slices.Equal(before.Genres, after.Genres) {
+		changes["genres"] = FieldChange{From: before.Genres, To: after.Genres}
+	}
+	if before.Synopsis != after.Synopsis {
+		changes["synopsis"] = FieldChange{From: nilIfZero(before.Synopsis), To: nilIfZero(after.Synopsis)}
+	}
+	if before.PosterURL != after.PosterURL {
+		changes["poster_url"] = FieldChange{From: nilIfZero(before.PosterURL), To: nilIfZero(after.PosterURL)}
+	}
+	if before.ThumbnailURL != after.ThumbnailURL {
+		changes["poster_thumbnail_url"] = FieldChange{From: nilIfZero(before.ThumbnailURL), To: nilIfZero(after.ThumbnailURL)}
+	}
+	if (before.DeletedAt == nil) != (after.DeletedAt == nil) {
+		changes["deleted_at"] = FieldChange{From: before.DeletedAt, To: after.DeletedAt}
+	}
+	return changes
+}
+
+func nilIfZero[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
+
+func formatRuntime(runtime int32) any {
+	if runtime == 0 {
+		return nil
+	}
+	return fmt.Sprintf("%d mins", runtime)
+}
+
+type RevisionModel struct {
+	DB DBTX
+}
+
+func (m RevisionModel) Insert(rev *MovieRevision) error {
+	changes, err := json.Marshal(rev.Changes)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(movieSnapshot{
+		Title:        rev.Snapshot.Title,
+		Year:         rev.Snapshot.Year,
+		Runtime:      rev.Snapshot.Runtime,
+		Genres:       rev.Snapshot.Genres,
+		Synopsis:     rev.Snapshot.Synopsis,
+		PosterURL:    rev.Snapshot.PosterURL,
+		ThumbnailURL: rev.Snapshot.ThumbnailURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO movie_revisions (movie_id, version, action, user_id, changes, snapshot)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+	args := []any{rev.MovieID, rev.Version, rev.Action, rev.UserID, changes, snapshot}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&rev.ID, &rev.CreatedAt)
+}
+
+func (m RevisionModel) GetAllForMovie(movieID int64, filters Filters) ([]*MovieRevision, Metadata, error) {
+	query := fmt.Sprintf(`SELECT count(*) OVER(), id, movie_id, version, action, user_id, created_at, changes, snapshot
+		FROM movie_revisions
+		WHERE movie_id = $1
+		ORDER BY %s LIMIT $2 OFFSET $3`, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	revisions := []*MovieRevision{}
+	totalRecords := 0
+	for rows.Next() {
+		var rev MovieRevision
+		err := scanRevision(rows, &rev, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		revisions = append(revisions, &rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return revisions, metadata, nil
+}
+
+// GetVersion returns the revision that produced the given version of a movie.
+func (m RevisionModel) GetVersion(movieID int64, version int32) (*MovieRevision, error) {
+	query := `SELECT 1, id, movie_id, version, action, user_id, created_at, changes, snapshot
+		FROM movie_revisions
+		WHERE movie_id = $1 AND version = $2
+		ORDER BY id DESC
+		LIMIT 1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rev MovieRevision
+	var total int
+	err := scanRevision(m.DB.QueryRowContext(ctx, query, movieID, version), &rev, &total)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &rev, nil
+}
+
+func scanRevision(row interface{ Scan(...any) error }, rev *MovieRevision, total *int) error {
+	var changes, snapshot []byte
+	err := row.Scan(
+		total,
+		&rev.ID,
+		&rev.MovieID,
+		&rev.Version,
+		&rev.Action,
+		&rev.UserID,
+		&rev.CreatedAt,
+		&changes,
+		&snapshot,
+	)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(changes, &rev.Changes)
+	if err != nil {
+		return err
+	}
+	var snap movieSnapshot
+	err = json.Unmarshal(snapshot, &snap)
+	if err != nil {
+		return err
+	}
+	rev.Snapshot = &Movie{
+		ID:           rev.MovieID,
+		Title:        snap.Title,
+		Year:         snap.Year,
+		Runtime:      snap.Runtime,
+		Genres:       snap.Genres,
+		Synopsis:     snap.Synopsis,
+		PosterURL:    snap.PosterURL,
+		ThumbnailURL: snap.ThumbnailURL,
+		Version:      rev.Version,
+	}
+	return nil
+}
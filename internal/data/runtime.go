@@ -2,6 +2,7 @@ package data
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -10,22 +11,30 @@ var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
 type Runtime int32
 
+func (r Runtime) MarshalJSON() ([]byte, error) {
+	jsonValue := fmt.Sprintf("%d mins", r)
+	return []byte(strconv.Quote(jsonValue)), nil
+}
+
 func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
 	if err != nil {
 		return ErrInvalidRuntimeFormat
 	}
+	*r, err = ParseRuntime(unquotedJSONValue)
+	return err
+}
 
-	parts := strings.Split(unquotedJSONValue, " ")
+// ParseRuntime parses a runtime in the "<minutes> mins" format used by the API.
+func ParseRuntime(s string) (Runtime, error) {
+	parts := strings.Split(s, " ")
 	if len(parts) != 2 || parts[1] != "mins" {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
 
 	i, err := strconv.ParseInt(parts[0], 10, 32)
 	if err != nil {
-		return ErrInvalidRuntimeFormat
+		return 0, ErrInvalidRuntimeFormat
 	}
-
-	*r = Runtime(i)
-	return nil
+	return Runtime(i), nil
 }
@@ -0,0 +1,101 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type MovieSimilarity struct {
+	MovieID   int64
+	SimilarID int64
+	Score     float64
+}
+
+// SimilarMovie is a movie recommended for another one, with its similarity
+// score between 0 and 1. The movie is a named field: embedding it would
+// promote Movie.MarshalJSON and drop the score from the JSON.
+type SimilarMovie struct {
+	Movie *Movie  `json:"movie"`
+	Score float64 `json:"score"`
+}
+
+type SimilarityModel struct {
+	DB DBTX
+}
+
+// Replace swaps the whole similarity table for the given rows. Run it in a
+// transaction so readers never see a half refreshed table.
+func (m SimilarityModel) Replace(rows []MovieSimilarity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM movie_similarities`)
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(rows); start += maxInsertBatch {
+		batch := rows[start:min(start+maxInsertBatch, len(rows))]
+
+		var values strings.Builder
+		args := make([]any, 0, len(batch)*3)
+		for i, row := range batch {
+			if i > 0 {
+				values.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&values, "($%d::bigint, $%d::bigint, $%d::real)", n+1, n+2, n+3)
+			args = append(args, row.MovieID, row.SimilarID, row.Score)
+		}
+		// Movies deleted since the scores were computed are skipped.
+		query := `
+			INSERT INTO movie_similarities (movie_id, similar_id, score)
+			SELECT v.movie_id, v.similar_id, v.score
+			FROM (VALUES ` + values.String() + `) AS v (movie_id, similar_id, score)
+			JOIN movies a ON a.id = v.movie_id
+			JOIN movies b ON b.id = v.similar_id`
+		_, err := m.DB.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetForMovie returns the movies most similar to the given one, best first.
+// Movies in the trash are left out.
+func (m SimilarityModel) GetForMovie(movieID int64, filters Filters) ([]*SimilarMovie, Metadata, error) {
+	// None of the movie columns clash with movie_similarities, so they
+	// can be selected unqualified.
+	query := `SELECT count(*) OVER(), score, ` + movieColumns + `
+		FROM movie_similarities
+		JOIN movies ON movies.id = similar_id
+		WHERE movie_id = $1 AND deleted_at IS NULL
+		ORDER BY score DESC, id ASC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	movies := []*SimilarMovie{}
+	totalRecords := 0
+	for rows.Next() {
+		similar := &SimilarMovie{Movie: &Movie{}}
+		err := rows.Scan(append([]any{&totalRecords, &similar.Score}, movieDest(similar.Movie)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movies = append(movies, similar)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return movies, metadata, nil
+}
@@ -0,0 +1,220 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// maxSlugTitle is the most runes of the title that go into a slug.
+const maxSlugTitle = 80
+
+// Slugify builds the slug of a movie from its title and year, such as
+// "the-matrix-1999". Slugs always end in the year, so they are never mistaken
+// for numeric ids.
+func Slugify(title string, year int32) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	base := strings.Join(words, "-")
+	if runes := []rune(base); len(runes) > maxSlugTitle {
+		base = strings.TrimRight(string(runes[:maxSlugTitle]), "-")
+	}
+	if base == "" {
+		base = "movie"
+	}
+	return base + "-" + strconv.Itoa(int(year))
+}
+
+// slugHasBase reports whether slug is base or base with a numeric suffix
+// added to make it unique, as in "the-matrix-1999-2".
+func slugHasBase(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(slug, base+"-")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(suffix)
+	return err == nil && n > 1 && strconv.Itoa(n) == suffix
+}
+
+// pickSlug returns base, or base with the smallest suffix from 2 upwards
+// that is not taken.
+func pickSlug(base string, taken map[string]bool) string {
+	if !taken[base] {
+		return base
+	}
+	for n := 2; ; n++ {
+		slug := base + "-" + strconv.Itoa(n)
+		if !taken[slug] {
+			return slug
+		}
+	}
+}
+
+// assignSlugs gives each movie a unique slug derived from its title and year.
+// Movies whose slug already derives from them keep it. Slugs other movies had
+// before are not handed out again so that their redirects keep working;
+// a movie may get its own old slug back.
+func (m MovieModel) assignSlugs(ctx context.Context, movies []*Movie) error {
+	var patterns []string
+	bases := make([]string, len(movies))
+	for i, movie := range movies {
+		bases[i] = Slugify(movie.Title, movie.Year)
+		// Slugs only contain letters, digits and hyphens, so they need no
+		// escaping in a LIKE pattern.
+		patterns = append(patterns, bases[i]+"%")
+	}
+
+	query := `
+		SELECT slug, id FROM movies WHERE slug LIKE ANY($1)
+		UNION ALL
+		SELECT slug, movie_id FROM movie_slugs WHERE slug LIKE ANY($1)`
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(patterns))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	owners := make(map[string]int64)
+	for rows.Next() {
+		var slug string
+		var id int64
+		err := rows.Scan(&slug, &id)
+		if err != nil {
+			return err
+		}
+		owners[slug] = id
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	assigned := make(map[string]bool)
+	for i, movie := range movies {
+		if movie.Slug != "" && slugHasBase(movie.Slug, bases[i]) && !assigned[movie.Slug] {
+			assigned[movie.Slug] = true
+			continue
+		}
+		taken := make(map[string]bool)
+		for slug, id := range owners {
+			if movie.ID == 0 || id != movie.ID {
+				taken[slug] = true
+			}
+		}
+		for slug := range assigned {
+			taken[slug] = true
+		}
+		movie.Slug = pickSlug(bases[i], taken)
+		assigned[movie.Slug] = true
+	}
+	return nil
+}
+
+// maxSlugAttempts bounds how often a write is retried after losing the race
+// for a slug to a concurrent one.
+const maxSlugAttempts = 5
+
+// withSlugRetry assigns slugs to movies and runs write, which saves them.
+// assignSlugs and write are separate statements, so a concurrent write can
+// take a slug in between; the write is then retried with fresh slugs. Inside
+// a transaction each attempt runs in a savepoint so that a failed one does
+// not abort it. On error the movies keep the slugs they had.
+func (m MovieModel) withSlugRetry(ctx context.Context, movies []*Movie, write func() error) error {
+	slugs := make([]string, len(movies))
+	for i, movie := range movies {
+		slugs[i] = movie.Slug
+	}
+	restore := func() {
+		for i, movie := range movies {
+			movie.Slug = slugs[i]
+		}
+	}
+	_, inTx := m.DB.(*sql.Tx)
+
+	for attempt := 1; ; attempt++ {
+		err := m.assignSlugs(ctx, movies)
+		if err != nil {
+			restore()
+			return err
+		}
+		if inTx {
+			_, err = m.DB.ExecContext(ctx, `SAVEPOINT movie_slug`)
+			if err != nil {
+				restore()
+				return err
+			}
+		}
+
+		err = write()
+		switch {
+		case err == nil:
+			if inTx {
+				_, err = m.DB.ExecContext(ctx, `RELEASE SAVEPOINT movie_slug`)
+			}
+			return err
+		case err.Error() == `pq: duplicate key value violates unique constraint "movies_slug_idx"` && attempt < maxSlugAttempts:
+			restore()
+			if inTx {
+				_, err = m.DB.ExecContext(ctx, `ROLLBACK TO SAVEPOINT movie_slug`)
+				if err != nil {
+					return err
+				}
+			}
+		default:
+			restore()
+			return err
+		}
+	}
+}
+
+// GetIDBySlug returns the id of the movie whose current slug is slug,
+// including movies in the trash.
+func (m MovieModel) GetIDBySlug(slug string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.DB.QueryRowContext(ctx, `SELECT id FROM movies WHERE slug = $1`, slug).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// GetSlugRedirect returns the current slug of the movie that used to be
+// known by slug.
+func (m MovieModel) GetSlugRedirect(slug string) (string, error) {
+	query := `
+		SELECT movies.slug
+		FROM movie_slugs
+		JOIN movies ON movies.id = movie_slugs.movie_id
+		WHERE movie_slugs.slug = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var current string
+	err := m.DB.QueryRowContext(ctx, query, slug).Scan(&current)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return current, nil
+}
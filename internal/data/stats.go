@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// runtimePercentiles are the percentiles reported in RuntimeStats, in the
+// order of its fields.
+var runtimePercentiles = []float64{0.1, 0.25, 0.5, 0.75, 0.9}
+
+// MovieStats summarizes the catalogue. Movies in the trash are left out.
+type MovieStats struct {
+	Total       int           `json:"total"`
+	Genres      []GenreCount  `json:"genres"`
+	Decades     []DecadeCount `json:"decades"`
+	Runtime     RuntimeStats  `json:"runtime"`
+	Recent      RecentStats   `json:"recent"`
+	GeneratedAt time.Time     `json:"generated_at"`
+}
+
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+type DecadeCount struct {
+	Decade int32 `json:"decade"`
+	Count  int   `json:"count"`
+}
+
+// RuntimeStats is the runtime distribution. Percentiles are runtimes of actual
+// movies rather than interpolated values.
+type RuntimeStats struct {
+	Min Runtime `json:"min"`
+	P10 Runtime `json:"p10"`
+	P25 Runtime `json:"p25"`
+	P50 Runtime `json:"p50"`
+	P75 Runtime `json:"p75"`
+	P90 Runtime `json:"p90"`
+	Max Runtime `json:"max"`
+}
+
+type RecentStats struct {
+	Last7Days  int            `json:"last_7_days"`
+	Last30Days int            `json:"last_30_days"`
+	Movies     []*RecentMovie `json:"movies"`
+}
+
+type RecentMovie struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Year      int32     `json:"year"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Stats computes the catalogue statistics, listing the recent most recently
+// added movies. All figures come from one snapshot of the movies table.
+func (m MovieModel) Stats(recent int) (*MovieStats, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx := m.DB
+	if db, ok := m.DB.(*sql.DB); ok {
+		t, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+		if err != nil {
+			return nil, err
+		}
+		defer t.Rollback()
+		tx = t
+	}
+
+	stats := &MovieStats{
+		Genres:      []GenreCount{},
+		Decades:     []DecadeCount{},
+		Recent:      RecentStats{Movies: []*RecentMovie{}},
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	query := `
+		SELECT count(*),
+			count(*) FILTER (WHERE created_at > now() - interval '7 days'),
+			count(*) FILTER (WHERE created_at > now() - interval '30 days'),
+			COALESCE(min(runtime), 0), COALESCE(max(runtime), 0),
+			COALESCE(percentile_disc($1::float8[]) WITHIN GROUP (ORDER BY runtime), '{}')
+		FROM movies
+		WHERE deleted_at IS NULL`
+	var percentiles []int64
+	err := tx.QueryRowContext(ctx, query, pq.Array(runtimePercentiles)).Scan(
+		&stats.Total,
+		&stats.Recent.Last7Days,
+		&stats.Recent.Last30Days,
+		&stats.Runtime.Min,
+		&stats.Runtime.Max,
+		pq.Array(&percentiles),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(percentiles) == len(runtimePercentiles) {
+		stats.Runtime.P10 = Runtime(percentiles[0])
+		stats.Runtime.P25 = Runtime(percentiles[1])
+		stats.Runtime.P50 = Runtime(percentiles[2])
+		stats.Runtime.P75 = Runtime(percentiles[3])
+		stats.Runtime.P90 = Runtime(percentiles[4])
+	}
+
+	query = `
+		SELECT genre, count(*)
+		FROM movies, unnest(genres) AS genre
+		WHERE deleted_at IS NULL
+		GROUP BY genre
+		ORDER BY count(*) DESC, genre ASC`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g GenreCount
+		if err := rows.Scan(&g.Genre, &g.Count); err != nil {
+			return nil, err
+		}
+		stats.Genres = append(stats.Genres, g)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT year / 10 * 10 AS decade, count(*)
+		FROM movies
+		WHERE deleted_at IS NULL
+		GROUP BY decade
+		ORDER BY decade ASC`
+	rows, err = tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DecadeCount
+		if err := rows.Scan(&d.Decade, &d.Count); err != nil {
+			return nil, err
+		}
+		stats.Decades = append(stats.Decades, d)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT id, title, year, created_at
+		FROM movies
+		WHERE deleted_at IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1`
+	rows, err = tx.QueryContext(ctx, query, recent)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var movie RecentMovie
+		if err := rows.Scan(&movie.ID, &movie.Title, &movie.Year, &movie.CreatedAt); err != nil {
+			return nil, err
+		}
+		stats.Recent.Movies = append(stats.Recent.Movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
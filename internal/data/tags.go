@@ -0,0 +1,318 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// Tags are visible as soon as they are created and wait in the moderation
+// queue as pending until a moderator approves, bans or merges them.
+const (
+	TagPending  = "pending"
+	TagApproved = "approved"
+	TagBanned   = "banned"
+	TagMerged   = "merged"
+)
+
+var TagStatuses = []string{TagPending, TagApproved, TagBanned, TagMerged}
+
+// MaxMovieTags is the number of tags a user can attach to a movie at once.
+const MaxMovieTags = 10
+
+var (
+	ErrBannedTag  = errors.New("banned tag")
+	ErrInvalidTag = errors.New("tag can not be merged")
+)
+
+var TagRX = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} '-]*$`)
+
+type Tag struct {
+	ID         int64     `json:"id"`
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	MergedInto *int64    `json:"merged_into,omitempty"`
+	Usage      int       `json:"usage"`
+	CreatedAt  time.Time `json:"created_at"`
+	Version    int32     `json:"version"`
+}
+
+// TagCount is a tag on a movie with the number of users who attached it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTag lower-cases a tag and collapses its whitespace so that
+// "Time  Travel" and "time travel" are the same tag.
+func NormalizeTag(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+func ValidateTags(v *validator.Validator, names []string) {
+	v.Check(len(names) > 0, "tags", "must contain at least 1 tag")
+	v.Check(len(names) <= MaxMovieTags, "tags", "must not contain more than 10 tags")
+	v.Check(validator.Unique(names), "tags", "must not contain duplicate values")
+	for _, name := range names {
+		if len(name) > 50 || !validator.Matches(name, TagRX) {
+			v.AddError("tags", "must only contain letters, digits, spaces, hyphens and apostrophes, and be at most 50 bytes long")
+			break
+		}
+	}
+}
+
+type TagModel struct {
+	DB DBTX
+}
+
+// Apply attaches tags to a movie on behalf of a user, creating the tags that
+// do not exist yet. Names of merged tags are resolved to the tag they were
+// merged into. Run it in a transaction: nothing is attached when one of the
+// tags is banned.
+func (m TagModel) Apply(movieID, userID int64, names []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO tags (name, created_by)
+		SELECT unnest($1::text[]), $2
+		ON CONFLICT (name) DO NOTHING`
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(names), userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT status, COALESCE(merged_into, id) FROM tags WHERE name = ANY($1)`, pq.Array(names))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var status string
+		var id int64
+		err := rows.Scan(&status, &id)
+		if err != nil {
+			return err
+		}
+		if status == TagBanned {
+			return ErrBannedTag
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO movie_tags (movie_id, tag_id, user_id)
+		SELECT $1, unnest($2::bigint[]), $3
+		ON CONFLICT DO NOTHING`
+	_, err = m.DB.ExecContext(ctx, query, movieID, pq.Array(ids), userID)
+	return err
+}
+
+// Remove detaches a tag that the user attached to a movie.
+func (m TagModel) Remove(movieID, userID int64, name string) error {
+	query := `
+		DELETE FROM movie_tags
+		WHERE movie_id = $1 AND user_id = $2
+			AND tag_id = (SELECT COALESCE(merged_into, id) FROM tags WHERE name = $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, userID, name)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// CountsForMovies returns the tags of the given movies, most used first,
+// keyed by movie id.
+func (m TagModel) CountsForMovies(movieIDs []int64) (map[int64][]TagCount, error) {
+	query := `
+		SELECT mt.movie_id, t.name, count(*)
+		FROM movie_tags mt
+		JOIN tags t ON t.id = mt.tag_id
+		WHERE mt.movie_id = ANY($1) AND t.status IN ('pending', 'approved')
+		GROUP BY mt.movie_id, t.name
+		ORDER BY mt.movie_id, count(*) DESC, t.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[int64][]TagCount)
+	for rows.Next() {
+		var movieID int64
+		var tc TagCount
+		err := rows.Scan(&movieID, &tc.Name, &tc.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts[movieID] = append(counts[movieID], tc)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+const tagColumns = `id, name, status, merged_into, created_at, version,
+	(SELECT count(*) FROM movie_tags WHERE tag_id = tags.id)`
+
+func tagDest(tag *Tag) []any {
+	return []any{&tag.ID, &tag.Name, &tag.Status, &tag.MergedInto, &tag.CreatedAt, &tag.Version, &tag.Usage}
+}
+
+func (m TagModel) Get(id int64) (*Tag, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tag Tag
+	err := m.DB.QueryRowContext(ctx, `SELECT `+tagColumns+` FROM tags WHERE id = $1`, id).Scan(tagDest(&tag)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tag, nil
+}
+
+// GetAll returns the tags with the given status, or all tags if status is
+// empty. The moderation queue is the list of pending tags.
+func (m TagModel) GetAll(status string, filters Filters) ([]*Tag, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM tags
+		WHERE (status = $1 OR $1 = '')
+		ORDER BY %s LIMIT $2 OFFSET $3`, tagColumns, filters.orderBy())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	tags := []*Tag{}
+	totalRecords := 0
+	for rows.Next() {
+		var tag Tag
+		err := rows.Scan(append([]any{&totalRecords}, tagDest(&tag)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		tags = append(tags, &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return tags, metadata, nil
+}
+
+// SetStatus approves or bans a tag. Banning also detaches it from every
+// movie, so run it in a transaction.
+func (m TagModel) SetStatus(tag *Tag, status string) error {
+	query := `
+		UPDATE tags
+		SET status = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, status, tag.ID, tag.Version).Scan(&tag.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	tag.Status = status
+	if status == TagBanned {
+		_, err = m.DB.ExecContext(ctx, `DELETE FROM movie_tags WHERE tag_id = $1`, tag.ID)
+		if err != nil {
+			return err
+		}
+		tag.Usage = 0
+	}
+	return nil
+}
+
+// Merge moves every use of source to target and makes source an alias of
+// target. Run it in a transaction.
+func (m TagModel) Merge(source, target *Tag) error {
+	if source.ID == target.ID || target.Status == TagBanned || target.Status == TagMerged || source.Status == TagMerged {
+		return ErrInvalidTag
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO movie_tags (movie_id, tag_id, user_id, created_at)
+		SELECT movie_id, $2, user_id, created_at FROM movie_tags WHERE tag_id = $1
+		ON CONFLICT DO NOTHING`
+	_, err := m.DB.ExecContext(ctx, query, source.ID, target.ID)
+	if err != nil {
+		return err
+	}
+	_, err = m.DB.ExecContext(ctx, `DELETE FROM movie_tags WHERE tag_id = $1`, source.ID)
+	if err != nil {
+		return err
+	}
+	// Earlier aliases of source follow it.
+	_, err = m.DB.ExecContext(ctx, `UPDATE tags SET merged_into = $2 WHERE merged_into = $1`, source.ID, target.ID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		UPDATE tags
+		SET status = 'merged', merged_into = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+	err = m.DB.QueryRowContext(ctx, query, target.ID, source.ID, source.Version).Scan(&source.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	source.Status = TagMerged
+	source.MergedInto = &target.ID
+	source.Usage = 0
+	return nil
+}
@@ -0,0 +1,162 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"lightsaber.dkadev.xyz/internal/validator"
+)
+
+// LocaleRX matches the normalized form of the language tags we store
+// translations under: a language optionally followed by a region, as in "fr"
+// or "pt-BR".
+var LocaleRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// MovieTranslation is the title and synopsis of a movie in one locale.
+type MovieTranslation struct {
+	MovieID   int64     `json:"-"`
+	Locale    string    `json:"locale"`
+	Title     string    `json:"title"`
+	Synopsis  string    `json:"synopsis,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+// NormalizeLocale brings a language tag into the form used by LocaleRX, so
+// that "PT_br" and "pt-BR" name the same locale. Tags it does not understand
+// are returned lower-cased and fail validation.
+func NormalizeLocale(tag string) string {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	lang, region, found := strings.Cut(tag, "-")
+	if !found {
+		return strings.ToLower(lang)
+	}
+	if len(region) == 2 {
+		region = strings.ToUpper(region)
+	} else {
+		region = strings.ToLower(region)
+	}
+	return strings.ToLower(lang) + "-" + region
+}
+
+// BaseLocale returns the language of a locale without its region.
+func BaseLocale(locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	return lang
+}
+
+func ValidateLocale(v *validator.Validator, locale string) {
+	v.Check(validator.Matches(locale, LocaleRX), "locale", "must be a language code such as fr or pt-BR")
+}
+
+// ValidateTranslation checks a translation. Translated titles follow the same
+// length rule as original ones.
+func ValidateTranslation(v *validator.Validator, t *MovieTranslation, rules MovieRules) {
+	ValidateLocale(v, t.Locale)
+	v.Check(t.Title != "", "title", "must be provided")
+	v.Check(len(t.Title) <= rules.MaxTitleBytes, "title", fmt.Sprintf("must not be more than %d bytes long", rules.MaxTitleBytes))
+	v.Check(len(t.Synopsis) <= 5000, "synopsis", "must not be more than 5000 bytes long")
+}
+
+// BestTranslation returns the translation for the first of locales that has
+// one, or nil if the movie should be shown untranslated. locales is in order
+// of preference.
+func BestTranslation(translations []*MovieTranslation, locales []string) *MovieTranslation {
+	for _, locale := range locales {
+		for _, t := range translations {
+			if t.Locale == locale {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+type TranslationModel struct {
+	DB DBTX
+}
+
+func (m TranslationModel) GetAllForMovie(movieID int64) ([]*MovieTranslation, error) {
+	translations, err := m.ForMovies([]int64{movieID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if translations[movieID] == nil {
+		return []*MovieTranslation{}, nil
+	}
+	return translations[movieID], nil
+}
+
+// ForMovies returns the translations of the given movies keyed by movie id,
+// limited to locales unless it is nil.
+func (m TranslationModel) ForMovies(movieIDs []int64, locales []string) (map[int64][]*MovieTranslation, error) {
+	query := `
+		SELECT movie_id, locale, title, synopsis, created_at, updated_at, version
+		FROM movie_translations
+		WHERE movie_id = ANY($1) AND (locale = ANY($2) OR $2 IS NULL)
+		ORDER BY movie_id, locale`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var localeArg any
+	if locales != nil {
+		localeArg = pq.Array(locales)
+	}
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(movieIDs), localeArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	translations := make(map[int64][]*MovieTranslation)
+	for rows.Next() {
+		var t MovieTranslation
+		err := rows.Scan(&t.MovieID, &t.Locale, &t.Title, &t.Synopsis, &t.CreatedAt, &t.UpdatedAt, &t.Version)
+		if err != nil {
+			return nil, err
+		}
+		translations[t.MovieID] = append(translations[t.MovieID], &t)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+// Upsert creates or replaces the translation of a movie in one locale.
+func (m TranslationModel) Upsert(t *MovieTranslation) error {
+	query := `
+		INSERT INTO movie_translations (movie_id, locale, title, synopsis)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (movie_id, locale) DO UPDATE
+		SET title = EXCLUDED.title, synopsis = EXCLUDED.synopsis,
+			updated_at = NOW(), version = movie_translations.version + 1
+		RETURNING created_at, updated_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, t.MovieID, t.Locale, t.Title, t.Synopsis).Scan(&t.CreatedAt, &t.UpdatedAt, &t.Version)
+}
+
+func (m TranslationModel) Delete(movieID int64, locale string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM movie_translations WHERE movie_id = $1 AND locale = $2`, movieID, locale)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
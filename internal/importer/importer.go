@@ -0,0 +1,264 @@
+// Package importer turns catalogue dumps in CSV or NDJSON format into movies.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"lightsaber.dkadev.xyz/internal/data"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var (
+	Formats = []string{FormatCSV, FormatNDJSON}
+	// Fields are the movie fields a column or key can be mapped to.
+	Fields = []string{"external_id", "title", "year", "runtime", "genres"}
+)
+
+var ErrNoTitle = errors.New("file has no column mapped to title")
+
+// Row is a single record of an import file. Errors holds problems converting
+// the record's values; the movie itself still has to be validated.
+type Row struct {
+	Line       int
+	ExternalID string
+	Movie      data.Movie
+	Errors     map[string]string
+}
+
+func (r *Row) addError(key, message string) {
+	if r.Errors == nil {
+		r.Errors = make(map[string]string)
+	}
+	if _, exists := r.Errors[key]; !exists {
+		r.Errors[key] = message
+	}
+}
+
+// Parse reads every record of src. mapping maps column names (or NDJSON keys)
+// to movie fields; columns that are not mapped are used if their name matches
+// a field case-insensitively and ignored otherwise.
+func Parse(format string, src []byte, mapping map[string]string) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(src, mapping)
+	case FormatNDJSON:
+		return parseNDJSON(src, mapping)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+func fieldFor(name string, mapping map[string]string) string {
+	if field, ok := mapping[name]; ok {
+		return field
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, field := range Fields {
+		if name == field {
+			return field
+		}
+	}
+	return ""
+}
+
+func parseCSV(src []byte, mapping map[string]string) ([]Row, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(src, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("file is empty")
+		}
+		return nil, err
+	}
+	fields := make([]string, len(header))
+	hasTitle := false
+	for i, name := range header {
+		fields[i] = fieldFor(name, mapping)
+		hasTitle = hasTitle || fields[i] == "title"
+	}
+	if !hasTitle {
+		return nil, ErrNoTitle
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// FieldPos must not be called after a failed Read, so take the
+			// line from the parse error instead.
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, err
+			}
+			row := Row{Line: parseErr.Line}
+			row.addError("line", parseErr.Err.Error())
+			rows = append(rows, row)
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: line}
+		for i, value := range record {
+			if i < len(fields) && fields[i] != "" {
+				setField(&row, fields[i], value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseNDJSON(src []byte, mapping map[string]string) ([]Row, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []Row
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		row := Row{Line: line}
+		var record map[string]any
+		err := json.Unmarshal(text, &record)
+		if err != nil {
+			row.addError("line", "must be a JSON object")
+			rows = append(rows, row)
+			continue
+		}
+		for key, value := range record {
+			if field := fieldFor(key, mapping); field != "" {
+				setField(&row, field, value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// setField converts a CSV string or decoded JSON value and stores it in the
+// given field of row.
+func setField(row *Row, field string, value any) {
+	if value == nil {
+		return
+	}
+	switch field {
+	case "external_id":
+		switch v := value.(type) {
+		case string:
+			row.ExternalID = strings.TrimSpace(v)
+		case float64:
+			row.ExternalID = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			row.addError(field, "must be a string")
+		}
+	case "title":
+		s, ok := value.(string)
+		if !ok {
+			row.addError(field, "must be a string")
+			return
+		}
+		row.Movie.Title = strings.TrimSpace(s)
+	case "year":
+		n, ok := toInt(value)
+		if !ok {
+			row.addError(field, "must be an integer")
+			return
+		}
+		row.Movie.Year = n
+	case "runtime":
+		if s, ok := value.(string); ok && !isDigits(strings.TrimSpace(s)) {
+			runtime, err := data.ParseRuntime(strings.TrimSpace(s))
+			if err != nil {
+				row.addError(field, `must be a number of minutes or in the format "<minutes> mins"`)
+				return
+			}
+			row.Movie.Runtime = int32(runtime)
+			return
+		}
+		n, ok := toInt(value)
+		if !ok {
+			row.addError(field, `must be a number of minutes or in the format "<minutes> mins"`)
+			return
+		}
+		row.Movie.Runtime = n
+	case "genres":
+		switch v := value.(type) {
+		case string:
+			row.Movie.Genres = splitGenres(v)
+		case []any:
+			genres := []string{}
+			for _, g := range v {
+				s, ok := g.(string)
+				if !ok {
+					row.addError(field, "must be a list of strings")
+					return
+				}
+				genres = append(genres, strings.TrimSpace(s))
+			}
+			row.Movie.Genres = genres
+		default:
+			row.addError(field, "must be a list of strings")
+		}
+	}
+}
+
+func toInt(value any) (int32, bool) {
+	switch v := value.(type) {
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 32)
+		return int32(n), err == nil
+	case float64:
+		if v != math.Trunc(v) || v > math.MaxInt32 || v < math.MinInt32 {
+			return 0, false
+		}
+		return int32(v), true
+	default:
+		return 0, false
+	}
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// splitGenres splits a genre list on "|", ";" or ",".
+func splitGenres(s string) []string {
+	genres := []string{}
+	for _, g := range strings.FieldsFunc(s, func(r rune) bool { return r == '|' || r == ';' || r == ',' }) {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+	return genres
+}
@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseCSV(t *testing.T) {
+	src := []byte("ID,Title,Year,Runtime,Genres,Director\n" +
+		"tt0133093,The Matrix,1999,136 mins,action|sci-fi,Wachowski\n" +
+		"tt0110912,\"Pulp Fiction\",1994,154,\"crime, drama\",Tarantino\n" +
+		"tt0000001,Broken,nineteen,long,drama,Nobody\n")
+
+	rows, err := Parse(FormatCSV, src, map[string]string{"ID": "external_id"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	first := rows[0]
+	if first.Line != 2 || first.ExternalID != "tt0133093" || first.Movie.Title != "The Matrix" ||
+		first.Movie.Year != 1999 || first.Movie.Runtime != 136 ||
+		!slices.Equal(first.Movie.Genres, []string{"action", "sci-fi"}) || first.Errors != nil {
+		t.Errorf("unexpected first row %+v", first)
+	}
+
+	second := rows[1]
+	if second.Movie.Runtime != 154 || !slices.Equal(second.Movie.Genres, []string{"crime", "drama"}) {
+		t.Errorf("unexpected second row %+v", second)
+	}
+
+	third := rows[2]
+	if _, ok := third.Errors["year"]; !ok {
+		t.Errorf("expected a year error, got %v", third.Errors)
+	}
+	if _, ok := third.Errors["runtime"]; !ok {
+		t.Errorf("expected a runtime error, got %v", third.Errors)
+	}
+}
+
+func TestParseCSVWithoutTitle(t *testing.T) {
+	_, err := Parse(FormatCSV, []byte("name,year\nThe Matrix,1999\n"), nil)
+	if !errors.Is(err, ErrNoTitle) {
+		t.Errorf("expected ErrNoTitle, got %v", err)
+	}
+
+	rows, err := Parse(FormatCSV, []byte("name,year\nThe Matrix,1999\n"), map[string]string{"name": "title"})
+	if err != nil || len(rows) != 1 || rows[0].Movie.Title != "The Matrix" {
+		t.Errorf("expected mapping to provide the title, got %v %v", rows, err)
+	}
+}
+
+func TestParseCSVMalformedRow(t *testing.T) {
+	src := []byte("title,year\n" +
+		"The Ma\"trix,1999\n" +
+		"Heat,1995\n")
+
+	rows, err := Parse(FormatCSV, src, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Line != 2 || rows[0].Errors["line"] == "" {
+		t.Errorf("expected a line error on line 2, got %+v", rows[0])
+	}
+	if rows[1].Line != 3 || rows[1].Movie.Title != "Heat" || rows[1].Errors != nil {
+		t.Errorf("unexpected second row %+v", rows[1])
+	}
+}
+
+func TestParseNDJSON(t *testing.T) {
+	src := []byte(`{"external_id":42,"title":"Moana","year":2016,"runtime":"107 mins","genres":["animation","adventure"]}
+
+{"title":"Bad","year":"soon","genres":[1]}
+not json
+`)
+
+	rows, err := Parse(FormatNDJSON, src, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(rows))
+	}
+
+	first := rows[0]
+	if first.ExternalID != "42" || first.Movie.Title != "Moana" || first.Movie.Runtime != 107 ||
+		!slices.Equal(first.Movie.Genres, []string{"animation", "adventure"}) || first.Errors != nil {
+		t.Errorf("unexpected first row %+v", first)
+	}
+	if rows[1].Line != 3 || rows[1].Errors["year"] == "" || rows[1].Errors["genres"] == "" {
+		t.Errorf("expected year and genres errors on line 3, got %+v", rows[1])
+	}
+	if rows[2].Line != 4 || rows[2].Errors["line"] == "" {
+		t.Errorf("expected a line error on line 4, got %+v", rows[2])
+	}
+}
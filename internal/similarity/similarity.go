@@ -0,0 +1,102 @@
+// Package similarity scores how alike two movies are for "more like this"
+// recommendations.
+package similarity
+
+import (
+	"slices"
+	"sort"
+)
+
+const (
+	genreWeight = 0.8
+	yearWeight  = 0.2
+	// yearSpan is the difference in years at which release years stop
+	// counting towards the score.
+	yearSpan = 20
+)
+
+// Item is the part of a movie the score is based on.
+type Item struct {
+	ID     int64
+	Year   int32
+	Genres []string
+}
+
+type Match struct {
+	ID    int64
+	Score float64
+}
+
+// Score rates a and b between 0 and 1. Genre overlap (the Jaccard index of
+// the genre sets) dominates, and movies released close together score a bit
+// higher. Movies without a genre in common always score 0.
+func Score(a, b Item) float64 {
+	genres := jaccard(a.Genres, b.Genres)
+	if genres == 0 {
+		return 0
+	}
+	diff := a.Year - b.Year
+	if diff < 0 {
+		diff = -diff
+	}
+	year := max(0, 1-float64(diff)/yearSpan)
+	return genreWeight*genres + yearWeight*year
+}
+
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for _, g := range a {
+		if slices.Contains(b, g) {
+			shared++
+		}
+	}
+	union := len(a) + len(b) - shared
+	return float64(shared) / float64(union)
+}
+
+// TopK returns the k best matches for every item, best first with ties broken
+// by id. Only items sharing at least one genre are compared, which keeps the
+// work well below comparing every pair for a real catalogue.
+func TopK(items []Item, k int) map[int64][]Match {
+	byGenre := make(map[string][]int)
+	for i, item := range items {
+		for _, g := range item.Genres {
+			byGenre[g] = append(byGenre[g], i)
+		}
+	}
+
+	result := make(map[int64][]Match, len(items))
+	seen := make([]bool, len(items))
+	for i, item := range items {
+		var matches []Match
+		var candidates []int
+		for _, g := range item.Genres {
+			for _, j := range byGenre[g] {
+				if j != i && !seen[j] {
+					seen[j] = true
+					candidates = append(candidates, j)
+				}
+			}
+		}
+		for _, j := range candidates {
+			seen[j] = false
+			if score := Score(item, items[j]); score > 0 {
+				matches = append(matches, Match{ID: items[j].ID, Score: score})
+			}
+		}
+		sort.Slice(matches, func(a, b int) bool {
+			if matches[a].Score != matches[b].Score {
+				return matches[a].Score > matches[b].Score
+			}
+			return matches[a].ID < matches[b].ID
+		})
+		if len(matches) > k {
+			matches = matches[:k]
+		}
+		result[item.ID] = matches
+	}
+	return result
+}
@@ -0,0 +1,74 @@
+package similarity
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// fixture is a small seeded catalogue with known relationships.
+var fixture = []Item{
+	{ID: 1, Year: 1977, Genres: []string{"sci-fi", "adventure", "action"}}, // A New Hope
+	{ID: 2, Year: 1980, Genres: []string{"sci-fi", "adventure", "action"}}, // Empire
+	{ID: 3, Year: 1983, Genres: []string{"sci-fi", "adventure", "action"}}, // Return of the Jedi
+	{ID: 4, Year: 1999, Genres: []string{"sci-fi", "action"}},              // The Matrix
+	{ID: 5, Year: 1994, Genres: []string{"crime", "drama"}},                // Pulp Fiction
+	{ID: 6, Year: 1972, Genres: []string{"crime", "drama"}},                // The Godfather
+	{ID: 7, Year: 2016, Genres: []string{"animation", "adventure"}},        // Moana
+	{ID: 8, Year: 2001, Genres: []string{"romance"}},                       // Amélie
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		a, b int
+		want float64
+	}{
+		{0, 1, 0.8*1 + 0.2*(1-3.0/20)},
+		{0, 3, 0.8*(2.0/3) + 0.2*0},
+		{4, 5, 0.8*1 + 0.2*0},
+		{0, 7, 0},
+	}
+	for _, tt := range tests {
+		got := Score(fixture[tt.a], fixture[tt.b])
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Score(%d, %d) = %v, want %v", fixture[tt.a].ID, fixture[tt.b].ID, got, tt.want)
+		}
+		if Score(fixture[tt.b], fixture[tt.a]) != got {
+			t.Errorf("Score(%d, %d) is not symmetric", fixture[tt.a].ID, fixture[tt.b].ID)
+		}
+	}
+}
+
+func TestTopK(t *testing.T) {
+	top := TopK(fixture, 3)
+
+	ids := func(matches []Match) []int64 {
+		var ids []int64
+		for _, m := range matches {
+			ids = append(ids, m.ID)
+		}
+		return ids
+	}
+	tests := map[int64][]int64{
+		1: {2, 3, 4},
+		2: {1, 3, 4},
+		5: {6},
+		7: {1, 2, 3},
+		8: nil,
+	}
+	for id, want := range tests {
+		if got := ids(top[id]); !slices.Equal(got, want) {
+			t.Errorf("top matches for %d = %v, want %v", id, got, want)
+		}
+	}
+
+	// The result does not depend on the order of the input.
+	reversed := slices.Clone(fixture)
+	slices.Reverse(reversed)
+	again := TopK(reversed, 3)
+	for id := range top {
+		if !slices.Equal(top[id], again[id]) {
+			t.Errorf("matches for %d depend on input order: %v vs %v", id, top[id], again[id])
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage is implemented by every backend that can hold uploaded files such
+// as movie posters. Keys are slash separated relative paths.
+type Storage interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
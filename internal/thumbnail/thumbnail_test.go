@@ -0,0 +1,60 @@
+package thumbnail
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	tests := []struct {
+		name    string
+		w, h    int
+		maxSize int
+		wantW   int
+		wantH   int
+	}{
+		{"landscape", 600, 300, 100, 100, 50},
+		{"portrait", 300, 600, 100, 50, 100},
+		{"already small", 80, 40, 100, 80, 40},
+		{"very thin", 1000, 2, 100, 100, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewRGBA(image.Rect(0, 0, tt.w, tt.h))
+			got := Resize(src, tt.maxSize).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("expected %dx%d, got %dx%d", tt.wantW, tt.wantH, got.Dx(), got.Dy())
+			}
+		})
+	}
+}
+
+func TestResizeAveragesPixels(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+	src.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+	got := Resize(src, 1).RGBAAt(0, 0)
+	if got.R < 126 || got.R > 128 || got.B < 126 || got.B > 128 || got.A != 255 {
+		t.Errorf("expected an even red/blue mix, got %v", got)
+	}
+}
+
+func TestJPEG(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	b, err := JPEG(src, 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("expected valid JPEG: %v", err)
+	}
+	if img.Bounds().Dx() != 100 || img.Bounds().Dy() != 50 {
+		t.Errorf("expected 100x50, got %v", img.Bounds())
+	}
+}
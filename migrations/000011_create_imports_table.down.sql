@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS imports;
+ALTER TABLE movies DROP COLUMN IF EXISTS external_id;
@@ -0,0 +1,21 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_id text UNIQUE;
+
+CREATE TABLE IF NOT EXISTS imports (
+    id bigserial PRIMARY KEY,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    status text NOT NULL DEFAULT 'pending',
+    format text NOT NULL,
+    dry_run boolean NOT NULL DEFAULT false,
+    mapping jsonb NOT NULL DEFAULT '{}',
+    source bytea NOT NULL,
+    total_rows integer NOT NULL DEFAULT 0,
+    processed_rows integer NOT NULL DEFAULT 0,
+    created integer NOT NULL DEFAULT 0,
+    updated integer NOT NULL DEFAULT 0,
+    failed integer NOT NULL DEFAULT 0,
+    errors jsonb NOT NULL DEFAULT '[]',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS imports_unfinished_idx ON imports (id) WHERE status IN ('pending', 'running');
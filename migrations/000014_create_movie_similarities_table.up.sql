@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS movie_similarities (
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    similar_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    score real NOT NULL,
+    PRIMARY KEY (movie_id, similar_id)
+);
+CREATE INDEX IF NOT EXISTS movie_similarities_movie_id_score_idx ON movie_similarities (movie_id, score DESC);
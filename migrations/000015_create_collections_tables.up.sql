@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS collections (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS collection_movies (
+    movie_id bigint PRIMARY KEY REFERENCES movies ON DELETE CASCADE,
+    collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+    position integer NOT NULL,
+    UNIQUE (collection_id, position)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS movie_tags;
+DROP TABLE IF EXISTS tags;
+DELETE FROM permissions WHERE code IN ('tags:write', 'tags:moderate');
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS movie_availability (
+    id bigserial PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    region text NOT NULL,
+    provider text NOT NULL,
+    type text NOT NULL CHECK (type IN ('stream', 'rent', 'buy')),
+    starts_on date NOT NULL,
+    ends_on date CHECK (ends_on >= starts_on),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT movie_availability_window_key UNIQUE (movie_id, region, provider, type, starts_on)
+);
+
+CREATE INDEX IF NOT EXISTS movie_availability_region_provider_idx ON movie_availability (region, provider, starts_on, ends_on);
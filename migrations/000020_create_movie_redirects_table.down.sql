@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS movie_redirects;
+DELETE FROM permissions WHERE code = 'movies:admin';
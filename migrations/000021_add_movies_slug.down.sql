@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS movie_slugs;
+DROP INDEX IF EXISTS movies_slug_idx;
+ALTER TABLE movies DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,27 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS slug text;
+
+UPDATE movies SET slug = numbered.slug
+FROM (
+    SELECT id, base || CASE WHEN n > 1 THEN '-' || n ELSE '' END AS slug
+    FROM (
+        SELECT id, base, row_number() OVER (PARTITION BY base ORDER BY id) AS n
+        FROM (
+            SELECT id, COALESCE(NULLIF(trim(both '-' FROM left(regexp_replace(lower(title), '[^[:alnum:]]+', '-', 'g'), 80)), ''), 'movie')
+                || '-' || year AS base
+            FROM movies
+        ) bases
+    ) ranked
+) numbered
+WHERE movies.id = numbered.id;
+
+ALTER TABLE movies ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS movies_slug_idx ON movies (slug text_pattern_ops);
+
+-- Slugs a movie had before its title or year changed, or that belonged to a
+-- movie merged into it. Requests for them are redirected to the current slug.
+CREATE TABLE IF NOT EXISTS movie_slugs (
+    slug text PRIMARY KEY,
+    movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS movie_slugs_movie_id_idx ON movie_slugs (movie_id);
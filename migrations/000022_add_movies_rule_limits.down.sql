@@ -0,0 +1,13 @@
+-- Restores the limits that applied before the movie rules were configurable:
+-- titles of at most 500 bytes, 1 to 5 genres and no years in the future.
+-- Movies saved under the looser limits may break them, so the constraints are
+-- added NOT VALID and only checked for new and updated rows. This migration
+-- does not validate them: rows that break the limits stay in the table until
+-- they are fixed by hand, after which each constraint can be checked with
+-- ALTER TABLE movies VALIDATE CONSTRAINT <name>.
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_title_length_check;
+ALTER TABLE movies ADD CONSTRAINT movies_title_length_check CHECK (octet_length(title) <= 500) NOT VALID;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS genres_length_check;
+ALTER TABLE movies ADD CONSTRAINT genres_length_check CHECK (array_length(genres, 1) BETWEEN 1 AND 5) NOT VALID;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_year_check;
+ALTER TABLE movies ADD CONSTRAINT movies_year_check CHECK (year BETWEEN 1888 AND date_part('year', now())) NOT VALID;
@@ -0,0 +1,5 @@
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_year_check;
+ALTER TABLE movies ADD CONSTRAINT movies_year_check CHECK (year BETWEEN 1888 AND date_part('year', now()) + 10);
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS genres_length_check;
+ALTER TABLE movies ADD CONSTRAINT genres_length_check CHECK (cardinality(genres) BETWEEN 1 AND 10);
+ALTER TABLE movies ADD CONSTRAINT movies_title_length_check CHECK (octet_length(title) <= 1000);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS movies_title_key_trgm_idx;
+DROP FUNCTION IF EXISTS movie_title_key(text);
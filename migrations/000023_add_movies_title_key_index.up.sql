@@ -0,0 +1,8 @@
+-- movie_title_key is the title the duplicate finder compares: lower-cased and
+-- without a leading article, so that "The Matrix" and "Matrix" are equal.
+-- pg_trgm ignores punctuation by itself.
+CREATE OR REPLACE FUNCTION movie_title_key(title text) RETURNS text
+    LANGUAGE sql IMMUTABLE PARALLEL SAFE
+    AS $$ SELECT regexp_replace(lower(title), '^[^[:alnum:]]*(the|a|an)[^[:alnum:]]+(?=[[:alnum:]])', '') $$;
+
+CREATE INDEX IF NOT EXISTS movies_title_key_trgm_idx ON movies USING GIN (movie_title_key(title) gin_trgm_ops) WHERE deleted_at IS NULL;
@@ -0,0 +1 @@
+ALTER TABLE movie_translations DROP CONSTRAINT IF EXISTS movie_translations_title_length_check;
@@ -0,0 +1 @@
+ALTER TABLE movie_translations ADD CONSTRAINT movie_translations_title_length_check CHECK (octet_length(title) <= 1000);